@@ -0,0 +1,144 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// ArtifactDir is the directory FuzzScheme and FuzzRoundTrip write a
+// reproducer bundle to for every round trip failure, see WriteArtifact.
+// Nothing is written if it is empty. Harnesses use WithArtifactDir.
+var ArtifactDir string
+
+// WriteArtifact writes everything needed to reproduce rtErr without the fuzzer
+// to a new directory under dir, and returns the path of that directory. data
+// and typeToTest are the arguments ExternalTypesViaJSON failed with. The
+// bundle holds:
+//
+//	summary.txt       kind, selector, codec, stage and error
+//	input             data as is
+//	input.libfuzzer   the input for FuzzRoundTrip
+//	input.gofuzz      the corpus entry for FuzzScheme
+//	original.yaml     the fuzzed object
+//	decoded.yaml      the object the codec produced, if any
+//	encoded           the encoded bytes, if any
+//	encoded.hex       a hex dump of the encoded bytes
+//	encoded.proto.txt the protobuf fields of the encoded bytes, if protobuf
+//	diff.txt          the diff, if any
+func WriteArtifact(dir string, data []byte, typeToTest int, rtErr *RoundTripError) (string, error) {
+	name := fmt.Sprintf("%s-%s-%x", artifactKindName(rtErr), rtErr.Stage, sha1.Sum(EncodeInput(typeToTest, data)))
+	bundle := filepath.Join(dir, name)
+	if err := os.MkdirAll(bundle, 0o755); err != nil {
+		return "", err
+	}
+
+	files := map[string][]byte{
+		"summary.txt":     []byte(artifactSummary(data, typeToTest, rtErr)),
+		"input":           data,
+		"input.libfuzzer": EncodeInput(typeToTest, data),
+		"input.gofuzz":    goFuzzEntry(data, typeToTest),
+		"original.yaml":   objectYAML(rtErr.Original),
+	}
+	if rtErr.Decoded != nil {
+		files["decoded.yaml"] = objectYAML(rtErr.Decoded)
+	}
+	if len(rtErr.Data) != 0 {
+		files["encoded"] = rtErr.Data
+		files["encoded.hex"] = []byte(hex.Dump(rtErr.Data))
+		if isProtobuf(rtErr.Data) {
+			files["encoded.proto.txt"] = []byte(protoDebugString(rtErr.Data))
+		}
+	}
+	if len(rtErr.Diff) != 0 {
+		files["diff.txt"] = []byte(rtErr.Diff + "\n")
+	}
+
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(bundle, file), content, 0o644); err != nil {
+			return "", err
+		}
+	}
+	return bundle, nil
+}
+
+// writeArtifact writes a bundle to the artifact directory of h, if it is set,
+// and returns a note about it for the failure message.
+func (h *Harness) writeArtifact(data []byte, typeToTest int, rtErr *RoundTripError) string {
+	if len(h.artifactDir) == 0 {
+		return ""
+	}
+	bundle, err := WriteArtifact(h.artifactDir, data, typeToTest, rtErr)
+	if err != nil {
+		return fmt.Sprintf("\ncould not write reproducer: %v", err)
+	}
+	return fmt.Sprintf("\nreproducer written to %s", bundle)
+}
+
+func artifactKindName(rtErr *RoundTripError) string {
+	parts := []string{rtErr.GVK.Group, rtErr.GVK.Version, rtErr.GVK.Kind}
+	if len(rtErr.GVK.Group) == 0 {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "_")
+}
+
+func artifactSummary(data []byte, typeToTest int, rtErr *RoundTripError) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "kind: %v\n", rtErr.GVK)
+	fmt.Fprintf(&b, "selector: %d\n", typeToTest)
+	fmt.Fprintf(&b, "codec: %s\n", rtErr.Codec)
+	fmt.Fprintf(&b, "stage: %s\n", rtErr.Stage)
+	if rtErr.Err != nil {
+		fmt.Fprintf(&b, "error: %v\n", rtErr.Err)
+	}
+	if len(rtErr.Fields) != 0 {
+		fmt.Fprintf(&b, "fields: %s\n", strings.Join(rtErr.Fields, ", "))
+	}
+	if len(rtErr.Conversions) != 0 {
+		fmt.Fprintf(&b, "conversions: %s\n", strings.Join(rtErr.Conversions, ", "))
+	}
+	// the selector only picks the same kind among the same kinds, so the
+	// harness that failed has to be rebuilt
+	fmt.Fprintf(&b, "\nreproduce with a Harness h configured like the one that failed, with the\n")
+	fmt.Fprintf(&b, "same scheme, fuzzer funcs and options, so that selector %d picks %v:\n", typeToTest, rtErr.GVK)
+	fmt.Fprintf(&b, "\tdata, _ := os.ReadFile(%q)\n", "input")
+	fmt.Fprintf(&b, "\terr := h.ExternalTypesViaJSON(data, %d)\n", typeToTest)
+	fmt.Fprintf(&b, "failures of the package level functions reproduce with the same roundtrip.Scheme\n")
+	fmt.Fprintf(&b, "and registered fuzzer funcs:\n")
+	fmt.Fprintf(&b, "\terr := roundtrip.ExternalTypesViaJSON(data, %d)\n", typeToTest)
+	return b.String()
+}
+
+// objectYAML marshals object, or describes why it couldn't.
+func objectYAML(object runtime.Object) []byte {
+	if object == nil {
+		return []byte("# no object\n")
+	}
+	out, err := yaml.Marshal(object)
+	if err != nil {
+		return []byte(fmt.Sprintf("# could not marshal %T: %v\n", object, err))
+	}
+	return out
+}
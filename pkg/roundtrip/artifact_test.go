@@ -0,0 +1,72 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+func TestWriteArtifact(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	err := defaultHarness().roundTrip(configMapGVK, "lossy", lossyCodec{Codec: jsonCodec}, testConfigMap())
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+
+	bundle, err := WriteArtifact(t.TempDir(), []byte("input"), 3, rtErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"summary.txt", "input", "input.libfuzzer", "input.gofuzz", "original.yaml", "decoded.yaml", "encoded", "encoded.hex", "diff.txt"} {
+		if _, err := os.Stat(filepath.Join(bundle, file)); err != nil {
+			t.Errorf("missing %s: %v", file, err)
+		}
+	}
+	original, err := os.ReadFile(filepath.Join(bundle, "original.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(original), "key: value") {
+		t.Errorf("unexpected original.yaml:\n%s", original)
+	}
+	summary, err := os.ReadFile(filepath.Join(bundle, "summary.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"selector 3 picks " + configMapGVK.String(), "h.ExternalTypesViaJSON(data, 3)"} {
+		if !strings.Contains(string(summary), want) {
+			t.Errorf("expected %q in summary.txt:\n%s", want, summary)
+		}
+	}
+}
+
+func TestProtoDebugString(t *testing.T) {
+	var buf strings.Builder
+	if err := protobuf.NewSerializer(Scheme, Scheme).Encode(testConfigMap(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := protoDebugString([]byte(buf.String())); !strings.Contains(s, `ConfigMap"`) {
+		t.Errorf("expected the kind in the debug print, got:\n%s", s)
+	}
+}
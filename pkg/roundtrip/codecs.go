@@ -0,0 +1,63 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"github.com/golang/protobuf/proto"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+var (
+	customSerializers = make([]runtime.SerializerInfo, 0)
+)
+
+// AddSerializers registers serializers that are round tripped in addition to
+// the media types supported by a CodecFactory. PrettySerializer and
+// StrictSerializer are exercised too when they are set.
+func AddSerializers(infos ...runtime.SerializerInfo) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	customSerializers = append(customSerializers, infos...)
+}
+
+// mediaTypes returns the serializers to round trip through.
+func (h *Harness) mediaTypes() []runtime.SerializerInfo {
+	codecFactory := serializer.NewCodecFactory(h.scheme)
+	if h.codecFactory != nil {
+		codecFactory = *h.codecFactory
+	}
+	infos := append([]runtime.SerializerInfo(nil), codecFactory.SupportedMediaTypes()...)
+	return append(infos, h.serializers...)
+}
+
+// supportsObject reports whether the serializer described by info can encode
+// object. Only protobuf is picky: it needs generated protobuf code.
+func supportsObject(info runtime.SerializerInfo, object runtime.Object) bool {
+	if info.MediaType != runtime.ContentTypeProtobuf {
+		return true
+	}
+	_, ok := object.(proto.Message)
+	return ok
+}
+
+func prettyCodecName(mediaType string) string {
+	return mediaType + " (pretty)"
+}
+
+func strictCodecName(mediaType string) string {
+	return mediaType + " (strict)"
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// conversionCodecName is reported as the codec of conversion failures.
+const conversionCodecName = "conversion via " + runtime.APIVersionInternal
+
+// InternalTypesViaJSON fuzzes an external object of the kind selected by
+// typeToTest, converts it to the internal version with Scheme.Convert and
+// back, and checks that nothing was lost. Only kinds with a registered
+// internal version are selected, see ConvertibleKinds. Failures are returned
+// as a *RoundTripError naming the conversion functions suspected of losing
+// data.
+func InternalTypesViaJSON(data []byte, typeToTest int) error {
+	return defaultHarness().InternalTypesViaJSON(data, typeToTest)
+}
+
+// InternalTypesViaJSON is like the package level InternalTypesViaJSON, for
+// the kinds of the scheme of h.
+func (h *Harness) InternalTypesViaJSON(data []byte, typeToTest int) error {
+	kinds := h.convertibleKinds()
+	if len(kinds) == 0 {
+		return fmt.Errorf("no kinds with an internal version are registered in the scheme")
+	}
+	return h.roundTripOfInternalType(data, selectKind(kinds, typeToTest))
+}
+
+func (h *Harness) roundTripOfInternalType(data []byte, externalGVK schema.GroupVersionKind) error {
+	object, err := h.scheme.New(externalGVK)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't make a %v? %v", externalGVK, err))
+	}
+	object, err = h.fuzzInternalObject(data, object)
+	h.stats.recordGeneration(externalGVK, err)
+	return h.stats.recordResult(externalGVK, h.checkConversion(externalGVK, object))
+}
+
+// checkConversion converts object to the internal version of externalGVK and
+// back, and checks that the result equals object.
+func (h *Harness) checkConversion(externalGVK schema.GroupVersionKind, object runtime.Object) error {
+	internalGVK := externalGVK.GroupKind().WithVersion(runtime.APIVersionInternal)
+	internal, err := h.scheme.New(internalGVK)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't make a %v? %v", internalGVK, err))
+	}
+	external, err := h.scheme.New(externalGVK)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't make a %v? %v", externalGVK, err))
+	}
+
+	fail := func(stage Stage, conversions ...string) *RoundTripError {
+		return &RoundTripError{GVK: externalGVK, Codec: conversionCodecName, Stage: stage, Original: object, Conversions: conversions}
+	}
+	if err := h.scheme.Convert(object.DeepCopyObject(), internal, nil); err != nil {
+		e := fail(StageConvertToInternal, conversionFuncName(object, internal))
+		e.Err = err
+		return e
+	}
+	if err := h.scheme.Convert(internal.DeepCopyObject(), external, nil); err != nil {
+		e := fail(StageConvertFromInternal, conversionFuncName(internal, object))
+		e.Err = err
+		return e
+	}
+
+	if !apiequality.Semantic.DeepEqual(object, external) {
+		r := h.compareFields(object, external)
+		e := fail(StageConversion, suspectConversions(r.owners, object, internal)...)
+		e.Decoded = external
+		e.Fields = r.paths
+		e.Diff = strings.Join(r.diffs, "\n")
+		return e
+	}
+	return nil
+}
+
+// suspectConversions returns the conversion functions, named the way
+// conversion-gen names them, that convert the structs owning the fields that
+// were lost. Structs from other packages, like ObjectMeta, are shared by the
+// external and the internal version and are not converted.
+func suspectConversions(owners []reflect.Type, external, internal runtime.Object) []string {
+	externalType := reflect.TypeOf(external).Elem()
+	internalType := reflect.TypeOf(internal).Elem()
+	externalPkg := path.Base(externalType.PkgPath())
+	internalPkg := path.Base(internalType.PkgPath())
+
+	names := sets.NewString()
+	for _, owner := range owners {
+		if owner.PkgPath() != externalType.PkgPath() || len(owner.Name()) == 0 {
+			continue
+		}
+		// nested structs are paired with the internal struct of the same
+		// name, only the kinds themselves are paired by the scheme
+		internalName := owner.Name()
+		if owner == externalType {
+			internalName = internalType.Name()
+		}
+		names.Insert(
+			funcName(externalPkg, owner.Name(), internalPkg, internalName),
+			funcName(internalPkg, internalName, externalPkg, owner.Name()),
+		)
+	}
+	if names.Len() == 0 {
+		return []string{conversionFuncName(external, internal), conversionFuncName(internal, external)}
+	}
+	return names.List()
+}
+
+// conversionFuncName returns the name conversion-gen gives the function
+// converting in to out.
+func conversionFuncName(in, out runtime.Object) string {
+	inType := reflect.TypeOf(in).Elem()
+	outType := reflect.TypeOf(out).Elem()
+	return funcName(path.Base(inType.PkgPath()), inType.Name(), path.Base(outType.PkgPath()), outType.Name())
+}
+
+func funcName(inPkg, inName, outPkg, outName string) string {
+	return fmt.Sprintf("Convert_%s_%s_To_%s_%s", inPkg, inName, outPkg, outName)
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var widgetGroupVersion = schema.GroupVersion{Group: "widgets.kubefuzzing.test", Version: "v1"}
+
+// widgetV1 is the external version of a test kind whose conversion drops
+// Color.
+type widgetV1 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Size              int64  `json:"size,omitempty"`
+	Color             string `json:"color,omitempty"`
+}
+
+func (w *widgetV1) DeepCopyObject() runtime.Object {
+	out := *w
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+// widget is the internal version of widgetV1.
+type widget struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+	Size  int64
+	Color string
+}
+
+func (w *widget) DeepCopyObject() runtime.Object {
+	out := *w
+	w.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+// newWidgetScheme returns a scheme with both versions of Widget.
+func newWidgetScheme(t testing.TB) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(widgetGroupVersion.WithKind("Widget"), &widgetV1{})
+	scheme.AddKnownTypeWithName(schema.GroupVersion{Group: widgetGroupVersion.Group, Version: runtime.APIVersionInternal}.WithKind("Widget"), &widget{})
+	err := scheme.AddConversionFunc((*widgetV1)(nil), (*widget)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		in, out := a.(*widgetV1), b.(*widget)
+		out.ObjectMeta = in.ObjectMeta
+		out.Size = in.Size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = scheme.AddConversionFunc((*widget)(nil), (*widgetV1)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		in, out := a.(*widget), b.(*widgetV1)
+		out.ObjectMeta = in.ObjectMeta
+		out.Size = in.Size
+		out.Color = in.Color
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestConvertibleKinds(t *testing.T) {
+	gvk := widgetGroupVersion.WithKind("Widget")
+	h := newHarness(t, WithScheme(newWidgetScheme(t)))
+	if kinds := h.ConvertibleKinds(); !reflect.DeepEqual(kinds, []schema.GroupVersionKind{gvk}) {
+		t.Errorf("expected only %v to be convertible, got %v", gvk, kinds)
+	}
+}
+
+func TestCheckConversion(t *testing.T) {
+	gvk := widgetGroupVersion.WithKind("Widget")
+	h := newHarness(t, WithScheme(newWidgetScheme(t)))
+	if err := h.checkConversion(gvk, &widgetV1{Size: 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := h.checkConversion(gvk, &widgetV1{Size: 3, Color: "blue"})
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageConversion {
+		t.Errorf("expected stage %s, got %s", StageConversion, rtErr.Stage)
+	}
+	expected := []string{
+		"Convert_roundtrip_widgetV1_To_roundtrip_widget",
+		"Convert_roundtrip_widget_To_roundtrip_widgetV1",
+	}
+	if !reflect.DeepEqual(rtErr.Conversions, expected) {
+		t.Errorf("expected conversions %v, got %v", expected, rtErr.Conversions)
+	}
+	if !reflect.DeepEqual(rtErr.Fields, []string{"Color"}) {
+		t.Errorf("expected Color to be lost, got %v", rtErr.Fields)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// selectorSize is the number of bytes EncodeInput uses for the kind selector.
+const selectorSize = 4
+
+// SeedCorpusOptions configures WriteSeedCorpus.
+type SeedCorpusOptions struct {
+	// LibFuzzerDir receives one file per seed, in the format read by
+	// FuzzRoundTrip. Nothing is written if it is empty.
+	LibFuzzerDir string
+	// GoFuzzDir receives one file per seed in the format of "go test -fuzz",
+	// usually testdata/fuzz/<FuzzTarget> of a target calling FuzzScheme.
+	// Nothing is written if it is empty.
+	GoFuzzDir string
+	// SeedsPerKind is the number of seeds kept for every kind. Defaults to 4.
+	SeedsPerKind int
+	// Candidates is the number of inputs generated for every kind, of which
+	// the ones that populate the most fields are kept. Inputs that populate
+	// no field at all are never kept. Defaults to 64.
+	Candidates int
+	// InputSize is the length of the generated inputs. Defaults to 4096.
+	InputSize int
+	// RandSeed makes a different but still reproducible corpus.
+	RandSeed int64
+}
+
+func (o *SeedCorpusOptions) setDefaults() {
+	if o.SeedsPerKind <= 0 {
+		o.SeedsPerKind = 4
+	}
+	if o.Candidates <= 0 {
+		o.Candidates = 64
+	}
+	if o.Candidates < o.SeedsPerKind {
+		o.Candidates = o.SeedsPerKind
+	}
+	if o.InputSize <= 0 {
+		o.InputSize = 4096
+	}
+}
+
+// EncodeInput prepends the kind selector to data, giving a single input that
+// FuzzRoundTrip tests exactly like ExternalTypesViaJSON(data, typeToTest).
+func EncodeInput(typeToTest int, data []byte) []byte {
+	input := make([]byte, selectorSize, selectorSize+len(data))
+	binary.BigEndian.PutUint32(input, uint32(typeToTest))
+	return append(input, data...)
+}
+
+// DecodeInput splits an input made by EncodeInput. It returns false if input
+// is too short to hold a selector.
+func DecodeInput(input []byte) (typeToTest int, data []byte, ok bool) {
+	if len(input) < selectorSize {
+		return 0, nil, false
+	}
+	return int(int32(binary.BigEndian.Uint32(input))), input[selectorSize:], true
+}
+
+// FuzzRoundTrip is a libFuzzer style entry point for ExternalTypesViaJSON.
+// The first four bytes of input select the kind, see EncodeInput. It panics
+// with the diff if an object does not survive a round trip, after writing a
+// reproducer to ArtifactDir if it is set.
+func FuzzRoundTrip(input []byte) int {
+	return defaultHarness().FuzzRoundTrip(input)
+}
+
+// FuzzRoundTrip is like the package level FuzzRoundTrip, for the kinds of the
+// scheme of h.
+func (h *Harness) FuzzRoundTrip(input []byte) int {
+	typeToTest, data, ok := DecodeInput(input)
+	if !ok {
+		return -1
+	}
+	err := h.ExternalTypesViaJSON(data, typeToTest)
+	var rtErr *RoundTripError
+	if errors.As(err, &rtErr) {
+		panic(rtErr.Error() + h.writeArtifact(data, typeToTest, rtErr))
+	}
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// WriteSeedCorpus generates seed inputs for every round trippable kind of
+// Scheme and writes them to the directories named in opts. Generation is
+// deterministic, so the same scheme and options always give the same corpus.
+func WriteSeedCorpus(opts SeedCorpusOptions) error {
+	return defaultHarness().WriteSeedCorpus(opts)
+}
+
+// WriteSeedCorpus is like the package level WriteSeedCorpus, for the kinds of
+// the scheme of h.
+func (h *Harness) WriteSeedCorpus(opts SeedCorpusOptions) error {
+	opts.setDefaults()
+	for _, dir := range []string{opts.LibFuzzerDir, opts.GoFuzzDir} {
+		if len(dir) == 0 {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	for typeToTest, gvk := range h.roundTrippableKinds() {
+		seeds, err := h.seedInputs(gvk, opts)
+		if err != nil {
+			return err
+		}
+		for _, seed := range seeds {
+			if len(opts.LibFuzzerDir) != 0 {
+				input := EncodeInput(typeToTest, seed)
+				name := fmt.Sprintf("%x", sha1.Sum(input))
+				if err := os.WriteFile(filepath.Join(opts.LibFuzzerDir, name), input, 0o644); err != nil {
+					return err
+				}
+			}
+			if len(opts.GoFuzzDir) != 0 {
+				entry := goFuzzEntry(seed, typeToTest)
+				name := fmt.Sprintf("%x", sha256.Sum256(entry))[:16]
+				if err := os.WriteFile(filepath.Join(opts.GoFuzzDir, name), entry, 0o644); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SeedInputs returns the seed inputs WriteSeedCorpus would write for gvk,
+// without the kind selector.
+func SeedInputs(gvk schema.GroupVersionKind, opts SeedCorpusOptions) ([][]byte, error) {
+	return defaultHarness().SeedInputs(gvk, opts)
+}
+
+// SeedInputs is like the package level SeedInputs, using the scheme and
+// fuzzer funcs of h.
+func (h *Harness) SeedInputs(gvk schema.GroupVersionKind, opts SeedCorpusOptions) ([][]byte, error) {
+	opts.setDefaults()
+	return h.seedInputs(gvk, opts)
+}
+
+func (h *Harness) seedInputs(gvk schema.GroupVersionKind, opts SeedCorpusOptions) ([][]byte, error) {
+	hash := fnv.New64a()
+	hash.Write([]byte(gvk.String()))
+	r := rand.New(rand.NewSource(int64(hash.Sum64()) ^ opts.RandSeed))
+
+	type candidate struct {
+		data  []byte
+		score int
+	}
+	candidates := make([]candidate, 0, opts.Candidates)
+	for i := 0; i < opts.Candidates; i++ {
+		object, err := h.scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, opts.InputSize)
+		r.Read(data)
+		if i%2 == 1 {
+			// small bytes make short slices and strings, so the input
+			// lasts for more fields
+			for j := range data {
+				data[j] %= 16
+			}
+		}
+		// objects that stopped early still score what they got, but
+		// inputs that populate nothing make no seeds
+		h.fuzzInternalObject(data, object)
+		if score := populatedFields(reflect.ValueOf(object)); score > 0 {
+			candidates = append(candidates, candidate{data: data, score: score})
+		}
+	}
+
+	// the most populated objects reach the deepest structs; the stable sort
+	// keeps generation order among equal scores
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	var seeds [][]byte
+	for _, c := range candidates {
+		if len(seeds) == opts.SeedsPerKind {
+			break
+		}
+		seeds = append(seeds, c.data)
+	}
+	return seeds, nil
+}
+
+// populatedFields counts the non-zero scalar values reachable from v.
+func populatedFields(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return populatedFields(v.Elem())
+	case reflect.Struct:
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			n += populatedFields(v.Field(i))
+		}
+		return n
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() == 0 {
+				return 0
+			}
+			return 1
+		}
+		n := 0
+		for i := 0; i < v.Len(); i++ {
+			n += populatedFields(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			n += 1 + populatedFields(iter.Value())
+		}
+		return n
+	case reflect.Invalid, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return 0
+	default:
+		if v.IsZero() {
+			return 0
+		}
+		return 1
+	}
+}
+
+// goFuzzEntry formats a corpus entry for the fuzz function of FuzzScheme.
+func goFuzzEntry(data []byte, typeToTest int) []byte {
+	return []byte(fmt.Sprintf("go test fuzz v1\n[]byte(%q)\nint(%d)\n", data, typeToTest))
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestEncodeInput(t *testing.T) {
+	for _, typeToTest := range []int{0, 7, -3} {
+		typeToTest2, data, ok := DecodeInput(EncodeInput(typeToTest, []byte("abc")))
+		if !ok || typeToTest2 != typeToTest || string(data) != "abc" {
+			t.Errorf("%d: got %d %q %v", typeToTest, typeToTest2, data, ok)
+		}
+	}
+	if _, _, ok := DecodeInput([]byte{1, 2}); ok {
+		t.Error("expected a short input to be rejected")
+	}
+}
+
+func TestWriteSeedCorpus(t *testing.T) {
+	dir := t.TempDir()
+	opts := SeedCorpusOptions{
+		LibFuzzerDir: filepath.Join(dir, "libfuzzer"),
+		GoFuzzDir:    filepath.Join(dir, "testdata", "fuzz", "FuzzExternalTypes"),
+		SeedsPerKind: 2,
+		Candidates:   16,
+		InputSize:    256,
+	}
+	if err := WriteSeedCorpus(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	libFuzzer, err := os.ReadDir(opts.LibFuzzerDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFuzz, err := os.ReadDir(opts.GoFuzzDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2 * len(RoundTrippableKinds()); len(libFuzzer) != want || len(goFuzz) != want {
+		t.Errorf("expected %d seeds in each directory, got %d and %d", want, len(libFuzzer), len(goFuzz))
+	}
+
+	entry, err := os.ReadFile(filepath.Join(opts.GoFuzzDir, goFuzz[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(entry), "go test fuzz v1\n[]byte(") {
+		t.Errorf("unexpected corpus entry %q", entry)
+	}
+
+	gvk := RoundTrippableKinds()[0]
+	a, _ := SeedInputs(gvk, opts)
+	b, _ := SeedInputs(gvk, opts)
+	if len(a) != 2 || !bytes.Equal(a[0], b[0]) {
+		t.Error("expected seed generation to be deterministic")
+	}
+}
+
+func TestSeedInputsArePopulated(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, WithScheme(scheme), WithFuncsPriority(PresetPriority, KubernetesFuzzerFuncs()))
+
+	gvk := corev1.SchemeGroupVersion.WithKind("Pod")
+	seeds, err := h.SeedInputs(gvk, SeedCorpusOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeds) == 0 {
+		t.Fatal("expected seeds for Pod")
+	}
+	for i, seed := range seeds {
+		object, err := scheme.New(gvk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.fuzzInternalObject(seed, object)
+		if n := populatedFields(reflect.ValueOf(object)); n == 0 {
+			t.Errorf("seed %d populates no fields", i)
+		}
+		if err := h.roundTripOfExternalType(seed, gvk, h.mediaTypes()); err != nil {
+			t.Errorf("seed %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"fmt"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultingCodecName is reported as the codec of defaulting failures.
+const defaultingCodecName = "defaulting"
+
+// DefaultedTypesViaJSON is like ExternalTypesViaJSON, but it applies the
+// defaulting funcs registered with Scheme to the fuzzed object first. It
+// checks that defaulting twice gives the same object as defaulting once, and
+// that the defaulted object survives a round trip through every media type.
+// Non-idempotent defaulters make clients see a diff on every apply.
+func DefaultedTypesViaJSON(data []byte, typeToTest int) error {
+	return defaultHarness().DefaultedTypesViaJSON(data, typeToTest)
+}
+
+// DefaultedTypesViaJSON is like the package level DefaultedTypesViaJSON, for
+// the kinds of the scheme of h.
+func (h *Harness) DefaultedTypesViaJSON(data []byte, typeToTest int) error {
+	kinds := h.roundTrippableKinds()
+	if len(kinds) == 0 {
+		return fmt.Errorf("no round trippable kinds are registered in the scheme")
+	}
+	return h.roundTripOfDefaultedType(data, selectKind(kinds, typeToTest), h.mediaTypes())
+}
+
+func (h *Harness) roundTripOfDefaultedType(data []byte, externalGVK schema.GroupVersionKind, serializers []runtime.SerializerInfo) error {
+	object, err := h.scheme.New(externalGVK)
+	if err != nil {
+		panic(fmt.Sprintf("Couldn't make a %v? %v", externalGVK, err))
+	}
+	object, err = h.fuzzInternalObject(data, object)
+	h.stats.recordGeneration(externalGVK, err)
+	return h.stats.recordResult(externalGVK, h.checkDefaulting(externalGVK, object, serializers))
+}
+
+// checkDefaulting defaults object, checks that defaulting is idempotent and
+// round trips the defaulted object.
+func (h *Harness) checkDefaulting(externalGVK schema.GroupVersionKind, object runtime.Object, serializers []runtime.SerializerInfo) error {
+	typeAcc, err := apimeta.TypeAccessor(object)
+	if err != nil {
+		panic(fmt.Sprintf("%q is not a TypeMeta and cannot be tested: %v", externalGVK, err))
+	}
+	typeAcc.SetKind(externalGVK.Kind)
+	typeAcc.SetAPIVersion(externalGVK.GroupVersion().String())
+
+	h.scheme.Default(object)
+	twice := object.DeepCopyObject()
+	h.scheme.Default(twice)
+	if !apiequality.Semantic.DeepEqual(object, twice) {
+		e := &RoundTripError{
+			GVK:      externalGVK,
+			Codec:    defaultingCodecName,
+			Stage:    StageDefaulting,
+			Original: object,
+			Decoded:  twice,
+		}
+		e.Fields, e.Diff = h.fieldDiffs(object, twice)
+		return e
+	}
+
+	return h.roundTripObject(externalGVK, object, serializers)
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCheckDefaulting(t *testing.T) {
+	gvk := widgetGroupVersion.WithKind("Widget")
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(gvk, &widgetV1{})
+	// Widgets without a size get a default size, but widgets with a size
+	// grow every time they are defaulted.
+	scheme.AddTypeDefaultingFunc(&widgetV1{}, func(obj interface{}) {
+		w := obj.(*widgetV1)
+		if w.Color == "growing" {
+			w.Size++
+		} else if w.Size == 0 {
+			w.Size = 1
+		}
+	})
+	h := newHarness(t, WithScheme(scheme))
+
+	serializers := h.mediaTypes()
+	if err := h.checkDefaulting(gvk, &widgetV1{}, serializers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := h.checkDefaulting(gvk, &widgetV1{Color: "growing"}, serializers)
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageDefaulting {
+		t.Errorf("expected stage %s, got %s", StageDefaulting, rtErr.Stage)
+	}
+	if len(rtErr.Fields) != 1 || rtErr.Fields[0] != "Size" {
+		t.Errorf("expected Size to differ, got %v", rtErr.Fields)
+	}
+}
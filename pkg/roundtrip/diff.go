@@ -0,0 +1,90 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fieldDiffReporter is a cmp.Reporter that records the path of every field
+// that differs, and the struct types those fields belong to.
+type fieldDiffReporter struct {
+	path   cmp.Path
+	paths  []string
+	diffs  []string
+	owners []reflect.Type
+}
+
+func (r *fieldDiffReporter) PushStep(ps cmp.PathStep) {
+	r.path = append(r.path, ps)
+}
+
+func (r *fieldDiffReporter) Report(rs cmp.Result) {
+	if rs.Equal() {
+		return
+	}
+	vx, vy := r.path.Last().Values()
+	r.paths = append(r.paths, r.path.String())
+	for i := len(r.path) - 1; i > 0; i-- {
+		if _, ok := r.path[i].(cmp.StructField); ok {
+			r.owners = append(r.owners, r.path[i-1].Type())
+			break
+		}
+	}
+	r.diffs = append(r.diffs, fmt.Sprintf("%#v:\n\t-: %s\n\t+: %s", r.path, formatValue(vx), formatValue(vy)))
+}
+
+func (r *fieldDiffReporter) PopStep() {
+	r.path = r.path[:len(r.path)-1]
+}
+
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<missing>"
+	}
+	if v.CanInterface() {
+		return fmt.Sprintf("%+v", v.Interface())
+	}
+	return v.String()
+}
+
+// fieldDiffs compares x and y field by field and returns the paths of the
+// fields that differ along with a readable report.
+func (h *Harness) fieldDiffs(x, y interface{}) ([]string, string) {
+	r := h.compareFields(x, y)
+	return r.paths, strings.Join(r.diffs, "\n")
+}
+
+func (h *Harness) compareFields(x, y interface{}) *fieldDiffReporter {
+	r := &fieldDiffReporter{}
+	opts := append([]cmp.Option{
+		// Types with unexported fields are compared like
+		// apiequality.Semantic compares them.
+		cmp.Comparer(func(a, b resource.Quantity) bool { return a.Cmp(b) == 0 }),
+		cmp.Comparer(func(a, b metav1.Time) bool { return a.Time.Equal(b.Time) }),
+		cmp.Comparer(func(a, b metav1.MicroTime) bool { return a.Time.Equal(b.Time) }),
+		cmp.Exporter(func(reflect.Type) bool { return true }),
+		cmp.Reporter(r),
+	}, h.cmpOpts...)
+	cmp.Equal(x, y, opts...)
+	return r
+}
@@ -0,0 +1,35 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFieldDiffsTime(t *testing.T) {
+	now := time.Now()
+	x := metav1.NewTime(now)
+	y := metav1.NewTime(now.Round(0).In(time.FixedZone("fuzz", 3600)))
+	if paths, diff := defaultHarness().fieldDiffs(x, y); len(paths) != 0 {
+		t.Errorf("expected the same instant to be equal, got %v: %s", paths, diff)
+	}
+	if paths, _ := defaultHarness().fieldDiffs(metav1.NewMicroTime(now), metav1.NewMicroTime(now.Add(time.Microsecond))); len(paths) != 1 {
+		t.Errorf("expected different instants to differ, got %v", paths)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+
+	gfh "github.com/AdaLogics/go-fuzz-headers"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxEncodedLength is the longest string or []byte generateValue generates,
+// since it reads their length from a single byte.
+const maxEncodedLength = math.MaxUint8
+
+// funcCall is a call of a fuzzer func: the pointer or map it filled and the
+// input it consumed.
+type funcCall struct {
+	funcType reflect.Type
+	target   reflect.Value
+	data     []byte
+	// ranOut is set if the call may have generated something else with
+	// more input, because it consumed the rest of it or doesn't generate
+	// the same from data followed by more
+	ranOut bool
+}
+
+// replayPadding is more input than any read of a fuzzer func fails for.
+const replayPadding = 2 * maxEncodedLength
+
+// recordingConsumer returns a consumer of data like newConsumer does, whose
+// fuzzer funcs record their calls in calls. The calls point to the values
+// the funcs filled, so these must not be changed afterwards.
+func (h *Harness) recordingConsumer(data []byte) (ff *gfh.ConsumeFuzzer, calls *[]funcCall) {
+	ff = h.newConsumer(data)
+	funcs := h.newConsumer(nil).Funcs
+	calls = new([]funcCall)
+	for t, fn := range funcs {
+		t, fn := t, fn
+		ff.Funcs[t] = reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+			start := consumedBytes(ff)
+			out := fn.Call(args)
+			end := consumedBytes(ff)
+			call := funcCall{funcType: t, target: args[0], data: data[start:end]}
+			call.ranOut = end >= len(data) || !replays(funcs, call)
+			*calls = append(*calls, call)
+			return out
+		})
+	}
+	return ff, calls
+}
+
+// replays reports whether the fuzzer func of call generates the same value
+// from the input of call followed by more, and consumes just that input.
+func replays(funcs map[reflect.Type]reflect.Value, call funcCall) bool {
+	ff := gfh.NewConsumer(append(append([]byte{}, call.data...), make([]byte, replayPadding)...))
+	ff.Funcs = funcs
+	var target reflect.Value
+	if call.funcType.Kind() == reflect.Map {
+		target = reflect.MakeMap(call.funcType)
+	} else {
+		target = reflect.New(call.funcType.Elem())
+	}
+	callFunc(ff, funcs[call.funcType], target)
+	return consumedBytes(ff) == len(call.data) && apiequality.Semantic.DeepEqual(target.Interface(), call.target.Interface())
+}
+
+// consumedBytes returns how much of its data ff has consumed, which
+// go-fuzz-headers doesn't export.
+func consumedBytes(ff *gfh.ConsumeFuzzer) int {
+	return int(reflect.ValueOf(ff).Elem().FieldByName("position").Uint())
+}
+
+// encodeObject returns an input that makes generateObject generate object,
+// the inverse of generateObject. funcs are the fuzzer funcs of the consumer,
+// and values that have one are written as the input of a call in calls that
+// generated an equal value. It fails if a value can't be generated, such as a
+// string longer than 255 bytes, a value of a fuzzer func that no call
+// generated, or a value after one that a call generated once the input ran out.
+func encodeObject(funcs map[reflect.Type]reflect.Value, calls []funcCall, object runtime.Object) ([]byte, error) {
+	// generateObject clears TypeMeta
+	object = object.DeepCopyObject()
+	typeAcc, err := apimeta.TypeAccessor(object)
+	if err != nil {
+		return nil, err
+	}
+	typeAcc.SetKind("")
+	typeAcc.SetAPIVersion("")
+
+	e := &inputEncoder{funcs: funcs, calls: calls}
+	if err := e.encodeValue(reflect.ValueOf(object).Elem(), 0); err != nil {
+		return nil, err
+	}
+	if err := e.encodeManagedFields(object); err != nil {
+		return nil, err
+	}
+	data := e.data[:e.end]
+	if e.end != 0 && e.end == e.next {
+		if e.ranOut {
+			return nil, fmt.Errorf("%v can't be generated from the end of an input", reflect.TypeOf(object).Elem())
+		}
+		// nothing but the fuzzer func before reads it
+		data = append(data, 0)
+	}
+	return data, nil
+}
+
+// inputEncoder writes the input that makes generateValue generate a value.
+type inputEncoder struct {
+	funcs map[reflect.Type]reflect.Value
+	calls []funcCall
+	data  []byte
+	// end is the length of data without the trailing zero values, which
+	// are generated anyway once the input runs out
+	end int
+	// ranOut is set once a call that ran out of input is replayed, after
+	// which only zero values can be generated
+	ranOut bool
+	// next is where the input has to go on for the value written before it.
+	// GetString fails at the end of the input even for empty strings, and
+	// fuzzer funcs may have read such strings.
+	next int
+}
+
+// encodeValue is the inverse of generateValue.
+func (e *inputEncoder) encodeValue(v reflect.Value, depth int) error {
+	if depth > maxGenerateDepth || !v.CanSet() {
+		return nil
+	}
+	if _, ok := e.funcs[reflect.PtrTo(v.Type())]; ok {
+		return e.replay(reflect.PtrTo(v.Type()), v)
+	}
+	if _, ok := e.funcs[v.Type()]; ok && v.Kind() == reflect.Map {
+		return e.replay(v.Type(), v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := e.encodeValue(v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		e.writeBool(!v.IsNil())
+		if v.IsNil() {
+			return e.written(v.Type(), true)
+		}
+		if err := e.extend(v.Type()); err != nil {
+			return err
+		}
+		return e.encodeValue(v.Elem(), depth+1)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Len() > maxEncodedLength {
+				return fmt.Errorf("%v of %d bytes can't be generated", v.Type(), v.Len())
+			}
+			e.data = append(e.data, byte(v.Len()))
+			e.data = append(e.data, v.Bytes()...)
+			break
+		}
+		if v.Len() >= maxGenerateElements {
+			return fmt.Errorf("%v of %d elements can't be generated", v.Type(), v.Len())
+		}
+		e.data = append(e.data, byte(v.Len()))
+		if v.Len() == 0 {
+			return e.written(v.Type(), true)
+		}
+		if err := e.extend(v.Type()); err != nil {
+			return err
+		}
+		// generateValue drops elements it runs out of input for, so even
+		// their zero values are written
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i), depth+1); err != nil {
+				return err
+			}
+			if err := e.extend(v.Type()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.Len() >= maxGenerateElements {
+			return fmt.Errorf("%v of %d entries can't be generated", v.Type(), v.Len())
+		}
+		e.data = append(e.data, byte(v.Len()))
+		if v.Len() == 0 {
+			return e.written(v.Type(), true)
+		}
+		if err := e.extend(v.Type()); err != nil {
+			return err
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			// map entries aren't settable, which generateValue skips
+			key := reflect.New(v.Type().Key()).Elem()
+			key.Set(iter.Key())
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			if err := e.encodeValue(key, depth+1); err != nil {
+				return err
+			}
+			if err := e.encodeValue(value, depth+1); err != nil {
+				return err
+			}
+			if err := e.extend(v.Type()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		if v.Len() > maxEncodedLength {
+			return fmt.Errorf("string of %d bytes can't be generated", v.Len())
+		}
+		e.data = append(e.data, byte(v.Len()))
+		e.data = append(e.data, v.String()...)
+		if v.Len() == 0 {
+			err := e.written(v.Type(), true)
+			e.next = len(e.data)
+			return err
+		}
+	case reflect.Bool:
+		e.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeUint64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.writeUint64(math.Float64bits(v.Float()))
+	default:
+		if !v.IsZero() {
+			return fmt.Errorf("%v can't be generated", v.Type())
+		}
+	}
+	return e.written(v.Type(), v.IsZero())
+}
+
+// replay writes the input of a call of the fuzzer func for funcType that
+// generated v.
+func (e *inputEncoder) replay(funcType reflect.Type, v reflect.Value) error {
+	for _, call := range e.calls {
+		generated := call.target
+		if generated.Kind() == reflect.Ptr {
+			generated = generated.Elem()
+		}
+		if call.funcType != funcType || !apiequality.Semantic.DeepEqual(generated.Interface(), v.Interface()) {
+			continue
+		}
+		if !call.ranOut {
+			e.data = append(e.data, call.data...)
+			e.next = len(e.data)
+			// fuzzer funcs may generate something else when the input
+			// runs out
+			return e.extend(v.Type())
+		}
+		if e.ranOut && len(call.data) != 0 {
+			return fmt.Errorf("%v was generated after the input ran out", v.Type())
+		}
+		// the call ran out of input, so the input has to end where its
+		// input ended
+		e.data = append(e.data[:e.end], call.data...)
+		e.end = len(e.data)
+		e.ranOut = true
+		return nil
+	}
+	if v.IsZero() {
+		// generation stopped before the fuzzer func was called, which the
+		// input has to end for
+		e.data = e.data[:e.end]
+		e.ranOut = true
+		return nil
+	}
+	return fmt.Errorf("no call of the fuzzer func for %v generated %+v", v.Type(), v.Interface())
+}
+
+// writeBool writes what GetBool reads as b.
+func (e *inputEncoder) writeBool(b bool) {
+	if b {
+		e.data = append(e.data, 0)
+	} else {
+		e.data = append(e.data, 1)
+	}
+}
+
+// writeUint64 writes what GetUint64 reads as i.
+func (e *inputEncoder) writeUint64(i uint64) {
+	e.data = binary.LittleEndian.AppendUint64(e.data, i)
+	e.writeBool(true)
+}
+
+// writeInclude writes what includeField reads as include. Once the input runs
+// out every field is included, so only excluded fields extend it.
+func (e *inputEncoder) writeInclude(include bool) error {
+	e.writeBool(include)
+	return e.written(reflect.TypeOf(include), include)
+}
+
+// written extends the input by what was written for a value of type t,
+// unless zero is set and the input doesn't have to go on. Zero values are
+// generated anyway once the input runs out.
+func (e *inputEncoder) written(t reflect.Type, zero bool) error {
+	if zero && (e.next == 0 || e.end != e.next) {
+		return nil
+	}
+	return e.extend(t)
+}
+
+// extend makes the input end after what was written for a value of type t.
+func (e *inputEncoder) extend(t reflect.Type) error {
+	if len(e.data) == e.end {
+		return nil
+	}
+	if e.ranOut {
+		return fmt.Errorf("%v was generated after the input ran out", t)
+	}
+	e.end = len(e.data)
+	return nil
+}
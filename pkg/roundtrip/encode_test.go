@@ -0,0 +1,67 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEncodeObject(t *testing.T) {
+	h := newHarness(t, WithScheme(Scheme), WithKubernetesFuzzerFuncs())
+	gvk := corev1.SchemeGroupVersion.WithKind("Pod")
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 32; i++ {
+		data := make([]byte, r.Intn(4096))
+		r.Read(data)
+		for j := range data {
+			data[j] %= 16
+		}
+
+		ff, calls := h.recordingConsumer(data)
+		generated := &corev1.Pod{}
+		generateObject(ff, generated)
+		pod := generated.DeepCopy()
+		setTypeMeta(pod, gvk)
+		input, err := encodeObject(ff.Funcs, *calls, pod)
+		if err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+		regenerated, err := h.generateExternal(gvk, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !apiequality.Semantic.DeepEqual(pod, regenerated) {
+			t.Errorf("input %d generates another pod:\n%s", i, cmp.Diff(pod, regenerated))
+		}
+	}
+
+	// values of fuzzer funcs are only written as generated
+	ff, calls := h.recordingConsumer(nil)
+	generated := &corev1.Pod{}
+	generateObject(ff, generated)
+	pod := generated.DeepCopy()
+	pod.ObjectMeta = metav1.ObjectMeta{Name: strings.Repeat("a", 256)}
+	if _, err := encodeObject(ff.Funcs, *calls, pod); err == nil {
+		t.Error("expected an error for an object meta no fuzzer func generated")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Stage identifies the step of a round trip that failed.
+type Stage string
+
+const (
+	// StageDeepCopy means DeepCopyObject returned an object that is not
+	// semantically equal to the original.
+	StageDeepCopy Stage = "DeepCopy"
+	// StageCopyAliasing means the original object changed after its deep
+	// copy was round tripped, so the copy shares memory with it.
+	StageCopyAliasing Stage = "CopyAliasing"
+	// StageEncodeAltered means encoding modified the object that was encoded.
+	StageEncodeAltered Stage = "EncodeAltered"
+	// StageEncode means the second encode of an object that was already
+	// encoded once failed.
+	StageEncode Stage = "Encode"
+	// StageUnstableEncoding means two encodes of the same object produced
+	// different bytes.
+	StageUnstableEncoding Stage = "UnstableEncoding"
+	// StageDecode means the codec could not decode its own output.
+	StageDecode Stage = "Decode"
+	// StageSemanticDiff means the decoded object differs from the original.
+	StageSemanticDiff Stage = "SemanticDiff"
+	// StageDecodeInto means DecodeInto could not decode the codec's output.
+	StageDecodeInto Stage = "DecodeInto"
+	// StageDecodeIntoDiff means the object produced by DecodeInto differs from
+	// the original.
+	StageDecodeIntoDiff Stage = "DecodeIntoDiff"
+	// StageStrictDecode means the strict decoder rejected the encoder's own
+	// output because of duplicate or unknown fields.
+	StageStrictDecode Stage = "StrictDecode"
+	// StagePrettyParity means the indented and the compact JSON encodings of
+	// an object decode to different objects.
+	StagePrettyParity Stage = "PrettyParity"
+	// StageCrossCodec means an object decodes to different objects depending
+	// on the codec that encoded it.
+	StageCrossCodec Stage = "CrossCodec"
+	// StageConvertToInternal means an external object could not be converted
+	// to its internal version.
+	StageConvertToInternal Stage = "ConvertToInternal"
+	// StageConvertFromInternal means an internal object could not be
+	// converted back to its external version.
+	StageConvertFromInternal Stage = "ConvertFromInternal"
+	// StageConversion means converting to the internal version and back
+	// changed the object.
+	StageConversion Stage = "Conversion"
+	// StageDefaulting means defaulting an object that was already defaulted
+	// changed it.
+	StageDefaulting Stage = "Defaulting"
+	// StageValidationPanic means the validation registered for a kind
+	// panicked.
+	StageValidationPanic Stage = "ValidationPanic"
+	// StageValidationChanged means a round trip changed the result of the
+	// validation registered for a kind.
+	StageValidationChanged Stage = "ValidationChanged"
+	// StageToUnstructured means an object could not be converted to
+	// unstructured content.
+	StageToUnstructured Stage = "ToUnstructured"
+	// StageFromUnstructured means unstructured content could not be
+	// converted back to a typed object.
+	StageFromUnstructured Stage = "FromUnstructured"
+	// StageUnstructured means an object changed on its way through
+	// unstructured content.
+	StageUnstructured Stage = "Unstructured"
+	// StagePatchApply means a patch computed from two objects could not be
+	// applied to the first one.
+	StagePatchApply Stage = "PatchApply"
+	// StageStrategicMergePatch means a two-way strategic merge patch could
+	// not be created, or applying it did not give the object it was computed
+	// for.
+	StageStrategicMergePatch Stage = "StrategicMergePatch"
+	// StageJSONMergePatch means a JSON merge patch could not be created, or
+	// applying it did not give the object it was computed for.
+	StageJSONMergePatch Stage = "JSONMergePatch"
+	// StageManagedFields means the FieldsV1 of a managed fields entry did
+	// not survive a round trip byte for byte.
+	StageManagedFields Stage = "ManagedFields"
+	// StageTypeMeta means the kinds or TypeMeta of an object could not be
+	// looked up while comparing it.
+	StageTypeMeta Stage = "TypeMeta"
+)
+
+// RoundTripError is returned when an object does not survive a round trip
+// through a codec. It carries everything needed to understand the failure so
+// that callers can decide whether to panic, and tests can match on Stage with
+// errors.As.
+type RoundTripError struct {
+	// GVK is the kind that was being round tripped.
+	GVK schema.GroupVersionKind
+	// Codec names the codec that was used, usually its media type.
+	Codec string
+	// Stage is the step of the round trip that failed.
+	Stage Stage
+	// Original is the fuzzed object before it was encoded.
+	Original runtime.Object
+	// Decoded is the object produced by the codec, if any.
+	Decoded runtime.Object
+	// Data holds the encoded bytes, if any.
+	Data []byte
+	// Diff describes the difference between Original and Decoded, if any.
+	Diff string
+	// Fields lists the paths of the offending fields, if known.
+	Fields []string
+	// Conversions names the conversion functions suspected of losing data,
+	// if any.
+	Conversions []string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *RoundTripError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v: %s round trip failed at stage %s", e.GVK, e.Codec, e.Stage)
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	if len(e.Fields) != 0 {
+		fmt.Fprintf(&b, "\nfields: %s", strings.Join(e.Fields, ", "))
+	}
+	if len(e.Conversions) != 0 {
+		fmt.Fprintf(&b, "\nconversions: %s", strings.Join(e.Conversions, ", "))
+	}
+	if len(e.Diff) != 0 {
+		fmt.Fprintf(&b, "\ndiff: %s", e.Diff)
+	}
+	if len(e.Data) != 0 {
+		fmt.Fprintf(&b, "\nencoded: %s", encodedString(e.Data))
+	}
+	return b.String()
+}
+
+func (e *RoundTripError) Unwrap() error {
+	return e.Err
+}
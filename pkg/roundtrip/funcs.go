@@ -16,12 +16,203 @@
 package roundtrip
 
 import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	fuzz "github.com/AdaLogics/go-fuzz-headers"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Priorities of fuzzer funcs. A func replaces the func registered for the
+// same type with a lower priority, and is ignored if that func has a higher
+// one.
+const (
+	// PresetPriority is the priority of the funcs added by
+	// WithKubernetesFuzzerFuncs and WithKnativeFuzzerFuncs, so that funcs
+	// added with WithFuncs or RegisterFuncs override them.
+	PresetPriority = -1
+	// DefaultPriority is the priority of the funcs added by RegisterFuncs,
+	// MustAddFuncs, AddFuncs and WithFuncs.
+	DefaultPriority = 0
 )
 
 var (
-	customFuncs = make([][]interface{}, 0)
+	customFuncs = NewFuncRegistry()
 )
 
+// RegisterFuncs registers fuzzer funcs with DefaultPriority. Every func must
+// be a func(*T, fuzz.Continue) error that generates a T, or a func(M,
+// fuzz.Continue) error that fills a map of type M. It returns an error, and
+// registers none of them, if a func has another signature or targets the same
+// type as another one of funcs or one that is already registered with the
+// same priority.
+func RegisterFuncs(funcs []interface{}) error {
+	return customFuncs.Add(DefaultPriority, funcs)
+}
+
+// MustAddFuncs is like RegisterFuncs but panics on errors. It is meant to be
+// called from init functions.
+func MustAddFuncs(funcs []interface{}) {
+	if err := RegisterFuncs(funcs); err != nil {
+		panic(err)
+	}
+}
+
+// AddFuncs is MustAddFuncs, under the name it had before fuzzer funcs were
+// checked.
 func AddFuncs(funcs []interface{}) {
-	customFuncs = append(customFuncs, funcs)
-}
\ No newline at end of file
+	MustAddFuncs(funcs)
+}
+
+// RegisterFuncsWithPriority is like RegisterFuncs, but registers funcs with
+// priority.
+func RegisterFuncsWithPriority(priority int, funcs []interface{}) error {
+	return customFuncs.Add(priority, funcs)
+}
+
+// FuncTypes returns the types that have a fuzzer func registered with
+// RegisterFuncs, MustAddFuncs or AddFuncs, sorted by name.
+func FuncTypes() []reflect.Type {
+	return customFuncs.Types()
+}
+
+// FuncConflictError is returned when two fuzzer funcs with the same priority
+// target the same type.
+type FuncConflictError struct {
+	Type     reflect.Type
+	Priority int
+}
+
+func (e *FuncConflictError) Error() string {
+	return fmt.Sprintf("more than one fuzzer func for %v with priority %d", e.Type, e.Priority)
+}
+
+// FuncRegistry holds at most one fuzzer func per target type. It is safe for
+// concurrent use.
+type FuncRegistry struct {
+	lock  sync.RWMutex
+	funcs map[reflect.Type]registeredFunc
+}
+
+type registeredFunc struct {
+	fn       interface{}
+	priority int
+}
+
+// NewFuncRegistry returns an empty FuncRegistry.
+func NewFuncRegistry() *FuncRegistry {
+	return &FuncRegistry{funcs: make(map[reflect.Type]registeredFunc)}
+}
+
+// Add registers funcs with priority, see RegisterFuncs. Funcs for types that
+// already have one with a higher priority are ignored. It returns a utilerrors.Aggregate with
+// an error for every func with the wrong signature and a *FuncConflictError
+// for every type that two funcs of the same priority target, in which case
+// none of funcs are registered.
+func (r *FuncRegistry) Add(priority int, funcs []interface{}) error {
+	added := make(map[reflect.Type]interface{}, len(funcs))
+	var errs []error
+	for _, fn := range funcs {
+		target, err := funcTarget(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := added[target]; ok {
+			errs = append(errs, &FuncConflictError{Type: target, Priority: priority})
+			continue
+		}
+		added[target] = fn
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for target := range added {
+		if existing, ok := r.funcs[target]; ok && existing.priority == priority {
+			errs = append(errs, &FuncConflictError{Type: target, Priority: priority})
+		}
+	}
+	if len(errs) != 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	for target, fn := range added {
+		if existing, ok := r.funcs[target]; ok && existing.priority > priority {
+			continue
+		}
+		r.funcs[target] = registeredFunc{fn: fn, priority: priority}
+	}
+	return nil
+}
+
+// Lookup returns the func registered for t and its priority.
+func (r *FuncRegistry) Lookup(t reflect.Type) (fn interface{}, priority int, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	f, ok := r.funcs[t]
+	return f.fn, f.priority, ok
+}
+
+// Types returns the types that have a func, sorted by name.
+func (r *FuncRegistry) Types() []reflect.Type {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	types := make([]reflect.Type, 0, len(r.funcs))
+	for t := range r.funcs {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return types
+}
+
+// Funcs returns the registered funcs, ordered like Types.
+func (r *FuncRegistry) Funcs() []interface{} {
+	types := r.Types()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	funcs := make([]interface{}, 0, len(types))
+	for _, t := range types {
+		if f, ok := r.funcs[t]; ok {
+			funcs = append(funcs, f.fn)
+		}
+	}
+	return funcs
+}
+
+var (
+	continueType = reflect.TypeOf(fuzz.Continue{})
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// funcTarget returns the type that fn generates, the type of its first
+// argument. It fails unless fn is a func(*T, fuzz.Continue) error or a
+// func(M, fuzz.Continue) error with M a map, the funcs go-fuzz-headers
+// accepts.
+func funcTarget(fn interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("fuzzer func %T is not a func, expected func(*T, fuzz.Continue) error", fn)
+	}
+	if reflect.ValueOf(fn).IsNil() {
+		return nil, fmt.Errorf("fuzzer func %T is nil", fn)
+	}
+	if t.NumIn() != 2 || t.IsVariadic() {
+		return nil, fmt.Errorf("fuzzer func %v takes %d arguments, expected func(*T, fuzz.Continue) error", t, t.NumIn())
+	}
+	if k := t.In(0).Kind(); k != reflect.Ptr && k != reflect.Map {
+		return nil, fmt.Errorf("fuzzer func %v takes a %v, expected a pointer to the value to generate or a map to fill", t, t.In(0))
+	}
+	if in := t.In(1); in != continueType {
+		if in.Name() == continueType.Name() {
+			return nil, fmt.Errorf("fuzzer func %v takes a %s.Continue, expected a %s.Continue", t, in.PkgPath(), continueType.PkgPath())
+		}
+		return nil, fmt.Errorf("fuzzer func %v takes a %v as second argument, expected a fuzz.Continue", t, in)
+	}
+	if t.NumOut() != 1 || t.Out(0) != errorType {
+		return nil, fmt.Errorf("fuzzer func %v does not return just an error", t)
+	}
+	return t.In(0), nil
+}
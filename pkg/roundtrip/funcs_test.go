@@ -0,0 +1,121 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	fuzz "github.com/AdaLogics/go-fuzz-headers"
+	gofuzz "github.com/google/gofuzz"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestFuncRegistry(t *testing.T) {
+	objectMetaType := reflect.TypeOf(&metav1.ObjectMeta{})
+	labelSelectorType := reflect.TypeOf(&metav1.LabelSelector{})
+	preset := func(*metav1.ObjectMeta, fuzz.Continue) error { return nil }
+	team := func(*metav1.ObjectMeta, fuzz.Continue) error { return nil }
+	selector := func(*metav1.LabelSelector, fuzz.Continue) error { return nil }
+
+	r := NewFuncRegistry()
+	if err := r.Add(PresetPriority, []interface{}{preset}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a conflict registers none of the funcs
+	err := r.Add(PresetPriority, []interface{}{selector, preset})
+	var agg utilerrors.Aggregate
+	if !errors.As(err, &agg) || len(agg.Errors()) != 1 {
+		t.Fatalf("expected one conflict, got %v", err)
+	}
+	var conflict *FuncConflictError
+	if !errors.As(agg.Errors()[0], &conflict) || conflict.Type != objectMetaType {
+		t.Fatalf("expected a conflict for %v, got %v", objectMetaType, err)
+	}
+	if _, _, ok := r.Lookup(labelSelectorType); ok {
+		t.Errorf("expected %v not to be registered", labelSelectorType)
+	}
+
+	// a higher priority overrides, a lower one is ignored
+	if err := r.Add(DefaultPriority, []interface{}{team, selector}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(PresetPriority, []interface{}{selector}); err != nil {
+		t.Fatal(err)
+	}
+	for typ, want := range map[reflect.Type]interface{}{objectMetaType: team, labelSelectorType: selector} {
+		fn, priority, ok := r.Lookup(typ)
+		if !ok || reflect.ValueOf(fn).Pointer() != reflect.ValueOf(want).Pointer() || priority != DefaultPriority {
+			t.Errorf("unexpected func for %v with priority %d", typ, priority)
+		}
+	}
+
+	if types := r.Types(); !reflect.DeepEqual(types, []reflect.Type{labelSelectorType, objectMetaType}) {
+		t.Errorf("unexpected types %v", types)
+	}
+	if funcs := r.Funcs(); len(funcs) != 2 {
+		t.Errorf("expected 2 funcs, got %d", len(funcs))
+	}
+}
+
+func TestFuncSignatures(t *testing.T) {
+	var nilFunc func(*metav1.ObjectMeta, fuzz.Continue) error
+	for _, tc := range []struct {
+		fn   interface{}
+		want string
+	}{
+		{fn: 1, want: "is not a func"},
+		{fn: nilFunc, want: "is nil"},
+		{fn: func(*metav1.ObjectMeta) error { return nil }, want: "takes 1 arguments"},
+		{fn: func(metav1.ObjectMeta, fuzz.Continue) error { return nil }, want: "expected a pointer"},
+		{fn: func(*metav1.ObjectMeta, gofuzz.Continue) error { return nil }, want: "takes a github.com/google/gofuzz.Continue"},
+		{fn: func(*metav1.ObjectMeta, *fuzz.Continue) error { return nil }, want: "as second argument"},
+		{fn: func(*metav1.ObjectMeta, fuzz.Continue) {}, want: "does not return just an error"},
+	} {
+		err := NewFuncRegistry().Add(DefaultPriority, []interface{}{tc.fn})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%T: expected an error containing %q, got %v", tc.fn, tc.want, err)
+		}
+	}
+
+	// like go-fuzz-headers, maps are filled in place
+	labels := func(map[string]string, fuzz.Continue) error { return nil }
+	r := NewFuncRegistry()
+	if err := r.Add(DefaultPriority, []interface{}{labels}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := r.Lookup(reflect.TypeOf(map[string]string{})); !ok {
+		t.Error("expected a func for map[string]string")
+	}
+
+	if err := RegisterFuncs([]interface{}{func() {}}); err == nil {
+		t.Error("expected RegisterFuncs to fail")
+	}
+	for name, add := range map[string]func([]interface{}){"MustAddFuncs": MustAddFuncs, "AddFuncs": AddFuncs} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s to panic", name)
+				}
+			}()
+			add([]interface{}{func() {}})
+		}()
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// defaultSeedInputs are added to the corpus for every kind unless
+// WithSeedInputs is used.
+var defaultSeedInputs = [][]byte{
+	{},
+	bytes.Repeat([]byte{0x02, 0x05, 'a', 'b', 'c', 'd', 'e'}, 64),
+}
+
+type fuzzOptions struct {
+	seeds [][]byte
+	stats io.Writer
+}
+
+// FuzzOption configures FuzzScheme.
+type FuzzOption func(*fuzzOptions)
+
+// WithSeedInputs replaces the default seed inputs that FuzzScheme adds to the
+// corpus for every kind.
+func WithSeedInputs(inputs ...[]byte) FuzzOption {
+	return func(o *fuzzOptions) {
+		o.seeds = inputs
+	}
+}
+
+// WithStats makes FuzzScheme write the statistics of the run to w as a table
+// when the fuzz test ends, see CollectStats.
+func WithStats(w io.Writer) FuzzOption {
+	return func(o *fuzzOptions) {
+		o.stats = w
+	}
+}
+
+// FuzzScheme runs ExternalTypesViaJSON as a native Go fuzz test. It is meant
+// to be called from a fuzz target:
+//
+//	func FuzzRoundTrip(f *testing.F) {
+//	  roundtrip.Scheme = myScheme
+//	  roundtrip.FuzzScheme(f)
+//	}
+//
+// The fuzz arguments are the raw input and the kind selector, so crashers
+// stored under testdata/fuzz can be replayed with plain "go test". Inputs that
+// can't be used are ignored; round trip failures fail the test with the diff,
+// and write a reproducer to ArtifactDir if it is set.
+func FuzzScheme(f *testing.F, opts ...FuzzOption) {
+	defaultHarness().Fuzz(f, opts...)
+}
+
+// Fuzz is like FuzzScheme, for the kinds of the scheme of h.
+func (h *Harness) Fuzz(f *testing.F, opts ...FuzzOption) {
+	o := fuzzOptions{seeds: defaultSeedInputs}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	numKinds := len(h.roundTrippableKinds())
+	if numKinds == 0 {
+		f.Fatal("the scheme has no round trippable kinds")
+	}
+	if o.stats != nil {
+		f.Cleanup(func() {
+			h.CollectStats().WriteTable(o.stats)
+		})
+	}
+	for typeToTest := 0; typeToTest < numKinds; typeToTest++ {
+		for _, seed := range o.seeds {
+			f.Add(seed, typeToTest)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, typeToTest int) {
+		err := h.ExternalTypesViaJSON(data, typeToTest)
+		var rtErr *RoundTripError
+		if errors.As(err, &rtErr) {
+			t.Fatalf("%v%s", rtErr, h.writeArtifact(data, typeToTest, rtErr))
+		}
+	})
+}
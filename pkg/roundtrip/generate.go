@@ -0,0 +1,263 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	gfh "github.com/AdaLogics/go-fuzz-headers"
+)
+
+const (
+	// maxGenerateDepth bounds the nesting of generated values, since API
+	// types such as JSONSchemaProps are recursive.
+	maxGenerateDepth = 32
+	// maxGenerateElements bounds the length of generated slices and maps, so
+	// that an input lasts for more than one field.
+	maxGenerateElements = 8
+)
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// generateValue fills v from ff. Values whose type has a fuzzer func in ff
+// are generated by it, other values field by field, element by element. This
+// differs from ff.GenerateWithCustom, which gives up at the first type that
+// has no fuzzer func, and so at the object itself. Generation stops at the
+// first error, usually because ff ran out of data, leaving the rest of v
+// empty.
+func generateValue(ff *gfh.ConsumeFuzzer, v reflect.Value, depth int) error {
+	if depth > maxGenerateDepth || !v.CanSet() {
+		return nil
+	}
+	if fn, ok := ff.Funcs[reflect.PtrTo(v.Type())]; ok {
+		return callFunc(ff, fn, v.Addr())
+	}
+	if fn, ok := ff.Funcs[v.Type()]; ok && v.Kind() == reflect.Map {
+		v.Set(reflect.MakeMap(v.Type()))
+		return callFunc(ff, fn, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := generateValue(ff, v.Field(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		set, err := ff.GetBool()
+		if err != nil || !set {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem())
+		v.Set(elem)
+		return generateValue(ff, elem.Elem(), depth+1)
+	case reflect.Slice:
+		n, err := ff.GetInt()
+		if err != nil {
+			return err
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// GetBytes fails on empty slices, ending generation
+			if n == 0 {
+				return nil
+			}
+			b, err := ff.GetNBytes(n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), n%maxGenerateElements, n%maxGenerateElements)
+		for i := 0; i < s.Len(); i++ {
+			if err := generateValue(ff, s.Index(i), depth+1); err != nil {
+				v.Set(s.Slice(0, i))
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := generateValue(ff, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := ff.GetInt()
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMap(v.Type())
+		v.Set(m)
+		for i := 0; i < n%maxGenerateElements; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := generateValue(ff, key, depth+1); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := generateValue(ff, value, depth+1); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+	case reflect.String:
+		s, err := ff.GetString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := ff.GetBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// GetInt reads a single byte, which never makes negative or large
+		// values
+		i, err := ff.GetUint64()
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(i))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := ff.GetUint64()
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := ff.GetFloat64()
+		if err != nil {
+			return err
+		}
+		// NaN never equals itself and JSON has no infinities
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			f = 0
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+// generateNoCustom fills the fields of the struct obj points to. Unlike
+// generateValue it ignores the fuzzer func of the struct itself, so that
+// fuzzer funcs can generate the fields they don't customize without calling
+// themselves, and nested values still go through their own fuzzer funcs.
+func generateNoCustom(c gfh.Continue, obj interface{}) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%T is not a pointer to a struct", obj)
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if err := generateValue(c.F, v.Field(i), 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callFunc calls the fuzzer func fn with target.
+func callFunc(ff *gfh.ConsumeFuzzer, fn reflect.Value, target reflect.Value) error {
+	out := fn.Call([]reflect.Value{target, reflect.ValueOf(gfh.Continue{F: ff})})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return fmt.Errorf("fuzzer func for %v: %w", target.Type(), err)
+	}
+	return nil
+}
+
+// sanitize drops the invalid UTF-8 from the strings reachable from v, keys of
+// maps included, and clears the values that don't marshal to valid JSON, such
+// as FieldsV1 holding random bytes or IntOrStrings of an unknown type. JSON
+// can't carry either, and fuzzer funcs that call GenerateStruct produce
+// plenty. Pointers to values marshaling to null are cleared too, since they
+// decode as nil.
+func sanitize(v reflect.Value) {
+	defer clearInvalidJSON(v)
+	switch v.Kind() {
+	case reflect.String:
+		if s := v.String(); v.CanSet() && !utf8.ValidString(s) {
+			v.SetString(strings.ToValidUTF8(s, ""))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		sanitize(v.Elem())
+		if !v.CanSet() {
+			return
+		}
+		if m, ok := v.Interface().(json.Marshaler); ok {
+			if data, err := m.MarshalJSON(); err == nil && bytes.Equal(data, []byte("null")) {
+				v.Set(reflect.Zero(v.Type()))
+			}
+		}
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		sanitize(elem)
+		v.Set(elem)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				sanitize(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			sanitize(v.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() || !v.CanSet() {
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := reflect.New(v.Type().Key()).Elem()
+			key.Set(iter.Key())
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			sanitize(key)
+			sanitize(value)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	}
+}
+
+// clearInvalidJSON zeroes v if it is a json.Marshaler failing or writing
+// invalid JSON.
+func clearInvalidJSON(v reflect.Value) {
+	if !v.CanSet() || v.Kind() == reflect.Interface || !v.Addr().Type().Implements(marshalerType) {
+		return
+	}
+	data, err := v.Addr().Interface().(json.Marshaler).MarshalJSON()
+	if err != nil || !json.Valid(data) {
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	gfh "github.com/AdaLogics/go-fuzz-headers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGenerateValue(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	for i := range data {
+		data[i] %= 16
+	}
+
+	// without fuzzer funcs every field is generated by kind
+	var pod corev1.Pod
+	generateValue(gfh.NewConsumer(data), reflect.ValueOf(&pod).Elem(), 0)
+	if populatedFields(reflect.ValueOf(&pod)) == 0 {
+		t.Error("expected a populated pod")
+	}
+
+	// ints cover their whole range, past what float64 holds exactly
+	var ints struct {
+		Small int8
+		Large int64
+	}
+	generateValue(gfh.NewConsumer([]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0,
+		1, 0, 0, 0, 0, 0, 0x30, 0, 0,
+	}), reflect.ValueOf(&ints).Elem(), 0)
+	if ints.Small != -1 || ints.Large != 1<<53+1<<52+1 {
+		t.Errorf("expected -1 and %d, got %+v", int64(1<<53+1<<52+1), ints)
+	}
+
+	// fuzzer funcs are used for the types they take
+	ff := gfh.NewConsumer(data)
+	ff.AddFuncs([]interface{}{func(s *corev1.PodSpec, c gfh.Continue) error {
+		s.NodeName = "fuzz"
+		return nil
+	}})
+	pod = corev1.Pod{}
+	generateValue(ff, reflect.ValueOf(&pod).Elem(), 0)
+	if pod.Spec.NodeName != "fuzz" || len(pod.Spec.Containers) != 0 {
+		t.Errorf("expected the spec to be generated by the fuzzer func, got %+v", pod.Spec)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "a\xffb",
+			Labels:            map[string]string{"\xfe": "\xfd"},
+			DeletionTimestamp: &metav1.Time{},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{FieldsV1: &metav1.FieldsV1{Raw: []byte{0x06}}},
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Ports: []corev1.ContainerPort{{Name: "http"}},
+				LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{Port: intstr.IntOrString{Type: 7}},
+				}},
+			}},
+		},
+	}
+	sanitize(reflect.ValueOf(pod))
+
+	if pod.Name != "ab" {
+		t.Errorf("expected invalid UTF-8 to be dropped, got %q", pod.Name)
+	}
+	if !reflect.DeepEqual(pod.Labels, map[string]string{"": ""}) {
+		t.Errorf("expected invalid UTF-8 to be dropped from maps, got %q", pod.Labels)
+	}
+	if pod.DeletionTimestamp != nil {
+		t.Error("expected a pointer to a zero time to be cleared")
+	}
+	if fields := pod.ManagedFields[0].FieldsV1; fields != nil {
+		t.Errorf("expected invalid FieldsV1 to be cleared, got %q", fields.Raw)
+	}
+	if port := pod.Spec.Containers[0].LivenessProbe.HTTPGet.Port; port != (intstr.IntOrString{}) {
+		t.Errorf("expected an IntOrString of an unknown type to be cleared, got %+v", port)
+	}
+}
@@ -17,6 +17,7 @@ package roundtrip
 
 import (
 	"fmt"
+	"reflect"
 
 	fuzz "github.com/AdaLogics/go-fuzz-headers"
 
@@ -25,15 +26,51 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var fuzzCodecFactory runtimeserializer.CodecFactory
+// fuzzCodecFactory encodes the objects embedded in fuzzed RawExtensions. They
+// are meta.k8s.io types, so it has a scheme of its own instead of the one
+// being fuzzed.
+var fuzzCodecFactory = newMetaCodecFactory()
 
+// SetCodecFactory replaces the codec factory used by the package level
+// functions and GenericFuzzerFuncs to encode the objects embedded in fuzzed
+// RawExtensions. Harnesses use WithRawExtensionCodecFactory.
 func SetCodecFactory(c runtimeserializer.CodecFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
 	fuzzCodecFactory = c
 }
 
+// rawExtensionCodec returns the codec that encodes the objects embedded in
+// fuzzed RawExtensions.
+func rawExtensionCodec() runtime.Codec {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	return rawExtensionCodecFor(fuzzCodecFactory)
+}
+
+func rawExtensionCodecFor(c runtimeserializer.CodecFactory) runtime.Codec {
+	return apitesting.TestCodec(c, metav1.SchemeGroupVersion)
+}
+
+func newMetaCodecFactory() runtimeserializer.CodecFactory {
+	scheme := runtime.NewScheme()
+	metav1.AddToGroupVersion(scheme, metav1.SchemeGroupVersion)
+	return runtimeserializer.NewCodecFactory(scheme)
+}
+
+// GenericFuzzerFuncs returns the fuzzer funcs for the types of
+// k8s.io/apimachinery. The objects embedded in RawExtensions are encoded with
+// the codec factory set by SetCodecFactory.
 func GenericFuzzerFuncs() []interface{} {
+	return genericFuzzerFuncs(rawExtensionCodec)
+}
+
+// genericFuzzerFuncs returns GenericFuzzerFuncs, encoding the objects
+// embedded in RawExtensions with the codec rawCodec returns.
+func genericFuzzerFuncs(rawCodec func() runtime.Codec) []interface{} {
 	return []interface{}{
 		func(q *resource.Quantity, c fuzz.Continue) error {
 			var newInt int
@@ -44,6 +81,27 @@ func GenericFuzzerFuncs() []interface{} {
 			*q = *resource.NewQuantity(int64(newInt%1000), resource.DecimalExponent)
 			return nil
 		},
+		func(j *intstr.IntOrString, c fuzz.Continue) error {
+			// only the field of the type is serialized
+			isInt, err := c.F.GetBool()
+			if err != nil {
+				return err
+			}
+			if isInt {
+				i, err := c.F.GetInt()
+				if err != nil {
+					return err
+				}
+				*j = intstr.FromInt(i)
+				return nil
+			}
+			s, err := c.F.GetString()
+			if err != nil {
+				return err
+			}
+			*j = intstr.FromString(s)
+			return nil
+		},
 		func(j *int, c fuzz.Continue) error {
 			var newInt int
 			newInt, err := c.F.GetInt()
@@ -95,7 +153,7 @@ func GenericFuzzerFuncs() []interface{} {
 					typeIndex = 0
 				}
 				t := types[typeIndex%len(types)]
-				c.F.GenerateWithCustom(t)
+				generateValue(c.F, reflect.ValueOf(t).Elem(), 1)
 				*j = t
 			}
 			return nil
@@ -109,11 +167,11 @@ func GenericFuzzerFuncs() []interface{} {
 				typeIndex = 0
 			}
 			obj := types[typeIndex%len(types)]
-			c.F.GenerateWithCustom(obj)
+			generateValue(c.F, reflect.ValueOf(obj).Elem(), 1)
 
 			// Find a codec for converting the object to raw bytes.  This is necessary for the
 			// api version and kind to be correctly set be serialization.
-			var codec = apitesting.TestCodec(fuzzCodecFactory, metav1.SchemeGroupVersion)
+			var codec = rawCodec()
 
 			// Convert the object to raw bytes
 			bytes, err := runtime.Encode(codec, obj)
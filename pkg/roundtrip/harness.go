@@ -0,0 +1,218 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Harness round trips the kinds of one scheme with its own fuzzer funcs, cmp
+// options, serializers, skip list, artifact directory and codec factory, so
+// that several fuzz targets in one binary don't share configuration. The
+// package level functions use a harness built from Scheme, AddFuncs, CmpOpts,
+// AddSerializers, AddValidation, ArtifactDir and SetCodecFactory. Every
+// harness has its own counters, see CollectStats.
+//
+// A Harness is safe for concurrent use once its scheme is no longer
+// modified. It lists the kinds of its scheme on first use, so types
+// registered later are not round tripped.
+type Harness struct {
+	scheme      *runtime.Scheme
+	funcs       *FuncRegistry
+	cmpOpts     []cmp.Option
+	serializers []runtime.SerializerInfo
+	skip        sets.String
+	validations map[schema.GroupVersionKind]ValidateFunc
+	stats       *statsCounters
+	artifactDir string
+	kinds       *kindsCache
+	// codecFactory makes the serializers to round trip through, one for
+	// the scheme if it is nil
+	codecFactory *runtimeserializer.CodecFactory
+	rawCodec     runtime.Codec
+}
+
+// HarnessOption configures a Harness.
+type HarnessOption func(*Harness) error
+
+// WithScheme sets the scheme whose kinds are round tripped. Defaults to an
+// empty scheme.
+func WithScheme(scheme *runtime.Scheme) HarnessOption {
+	return func(h *Harness) error {
+		h.scheme = scheme
+		return nil
+	}
+}
+
+// WithFuncs adds fuzzer funcs with DefaultPriority, like RegisterFuncs does
+// for the package level functions.
+func WithFuncs(funcs ...[]interface{}) HarnessOption {
+	return WithFuncsPriority(DefaultPriority, funcs...)
+}
+
+// WithFuncsPriority adds fuzzer funcs with priority, like
+// RegisterFuncsWithPriority does for the package level functions.
+func WithFuncsPriority(priority int, funcs ...[]interface{}) HarnessOption {
+	return func(h *Harness) error {
+		for _, f := range funcs {
+			if err := h.funcs.Add(priority, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCmpOptions adds options for the diffs of failed round trips, like
+// CmpOpts does for the package level functions.
+func WithCmpOptions(opts ...cmp.Option) HarnessOption {
+	return func(h *Harness) error {
+		h.cmpOpts = append(h.cmpOpts, opts...)
+		return nil
+	}
+}
+
+// WithSerializers adds serializers to round trip through, like
+// AddSerializers does for the package level functions.
+func WithSerializers(infos ...runtime.SerializerInfo) HarnessOption {
+	return func(h *Harness) error {
+		h.serializers = append(h.serializers, infos...)
+		return nil
+	}
+}
+
+// WithSkippedKinds adds kinds that are never round tripped, in any group or
+// version, to the ones that can't be round tripped at all, such as
+// WatchEvent.
+func WithSkippedKinds(kinds ...string) HarnessOption {
+	return func(h *Harness) error {
+		h.skip.Insert(kinds...)
+		return nil
+	}
+}
+
+// WithValidation registers validate for gvk, like AddValidation does for the
+// package level functions.
+func WithValidation(gvk schema.GroupVersionKind, validate ValidateFunc) HarnessOption {
+	return func(h *Harness) error {
+		h.validations[gvk] = validate
+		return nil
+	}
+}
+
+// WithArtifactDir sets the directory Fuzz and FuzzRoundTrip write a
+// reproducer bundle to for every round trip failure, like ArtifactDir does
+// for the package level functions. Nothing is written if it is empty, the
+// default.
+func WithArtifactDir(dir string) HarnessOption {
+	return func(h *Harness) error {
+		h.artifactDir = dir
+		return nil
+	}
+}
+
+// WithCodecFactory sets the codec factory whose supported media types are
+// round tripped through, in addition to the serializers of WithSerializers.
+// Defaults to a codec factory for the scheme.
+func WithCodecFactory(c runtimeserializer.CodecFactory) HarnessOption {
+	return func(h *Harness) error {
+		h.codecFactory = &c
+		return nil
+	}
+}
+
+// WithRawExtensionCodecFactory sets the codec factory that encodes the
+// objects embedded in the RawExtensions generated by the fuzzer funcs of
+// WithKubernetesFuzzerFuncs, like SetCodecFactory does for the package level
+// functions. Defaults to one for the meta.k8s.io types.
+func WithRawExtensionCodecFactory(c runtimeserializer.CodecFactory) HarnessOption {
+	return func(h *Harness) error {
+		h.rawCodec = rawExtensionCodecFor(c)
+		return nil
+	}
+}
+
+// NewHarness returns a Harness configured by opts. It fails if the fuzzer
+// funcs of opts conflict, see RegisterFuncs.
+func NewHarness(opts ...HarnessOption) (*Harness, error) {
+	h := &Harness{
+		scheme:      runtime.NewScheme(),
+		funcs:       NewFuncRegistry(),
+		skip:        sets.NewString(globalNonRoundTrippableTypes.List()...),
+		validations: make(map[schema.GroupVersionKind]ValidateFunc),
+		stats:       newStatsCounters(),
+		kinds:       &kindsCache{},
+		rawCodec:    rawExtensionCodecFor(newMetaCodecFactory()),
+	}
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// rawExtensionCodec returns the codec that encodes the objects embedded in
+// the RawExtensions generated for h.
+func (h *Harness) rawExtensionCodec() runtime.Codec {
+	return h.rawCodec
+}
+
+// Scheme returns the scheme of h.
+func (h *Harness) Scheme() *runtime.Scheme {
+	return h.scheme
+}
+
+// FuncTypes returns the types that have a fuzzer func in h, sorted by name.
+func (h *Harness) FuncTypes() []reflect.Type {
+	return h.funcs.Types()
+}
+
+// registryLock guards the registries of the package level functions:
+// customSerializers, validations and fuzzCodecFactory.
+var registryLock sync.RWMutex
+
+// defaultHarness returns the harness used by the package level functions. It
+// is built on every call so that changes to Scheme and CmpOpts are seen, and
+// holds copies of the registries so that it isn't affected by concurrent
+// registrations. customFuncs is shared since it is safe for concurrent use.
+func defaultHarness() *Harness {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	h := &Harness{
+		scheme:      Scheme,
+		funcs:       customFuncs,
+		cmpOpts:     append([]cmp.Option(nil), CmpOpts...),
+		serializers: append([]runtime.SerializerInfo(nil), customSerializers...),
+		skip:        globalNonRoundTrippableTypes,
+		validations: make(map[schema.GroupVersionKind]ValidateFunc, len(validations)),
+		stats:       defaultStats,
+		artifactDir: ArtifactDir,
+		kinds:       defaultKindsOf(Scheme),
+		rawCodec:    rawExtensionCodecFor(fuzzCodecFactory),
+	}
+	for gvk, validate := range validations {
+		h.validations[gvk] = validate
+	}
+	return h
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+func TestHarnessesAreIndependent(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, WithScheme(scheme), WithSkippedKinds("ConfigMap"))
+
+	contains := func(kinds []schema.GroupVersionKind, gvk schema.GroupVersionKind) bool {
+		for _, k := range kinds {
+			if k == gvk {
+				return true
+			}
+		}
+		return false
+	}
+	if contains(h.RoundTrippableKinds(), configMapGVK) {
+		t.Errorf("expected %v to be skipped by the harness", configMapGVK)
+	}
+	if !contains(RoundTrippableKinds(), configMapGVK) {
+		t.Errorf("expected %v to be round tripped by the package level functions", configMapGVK)
+	}
+	for _, s := range h.SkippedKinds() {
+		if s.GVK == configMapGVK && s.Reason != SkipReasonNonRoundTrippable {
+			t.Errorf("unexpected reason %q", s.Reason)
+		}
+	}
+
+	if err := newHarness(t).ExternalTypesViaJSON(nil, 0); err == nil {
+		t.Error("expected a harness without kinds to fail")
+	}
+	if err := h.ExternalTypesViaJSON(nil, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHarnessFuncConflicts(t *testing.T) {
+	if _, err := NewHarness(WithFuncs(GenericFuzzerFuncs(), GenericFuzzerFuncs())); err == nil {
+		t.Error("expected funcs for the same types to conflict")
+	}
+	h := newHarness(t, WithFuncsPriority(PresetPriority, GenericFuzzerFuncs()), WithFuncs(GenericFuzzerFuncs()))
+	if len(h.FuncTypes()) != len(GenericFuzzerFuncs()) {
+		t.Errorf("expected %d types, got %v", len(GenericFuzzerFuncs()), h.FuncTypes())
+	}
+}
+
+// newHarness returns a harness configured by opts and fails t if it can't.
+func newHarness(t testing.TB, opts ...HarnessOption) *Harness {
+	h, err := NewHarness(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHarnessArtifactDir(t *testing.T) {
+	dir := t.TempDir()
+	h := newHarness(t, WithArtifactDir(dir))
+
+	rtErr := &RoundTripError{GVK: configMapGVK, Codec: "lossy", Stage: StageSemanticDiff, Original: testConfigMap()}
+	if note := h.writeArtifact([]byte("input"), 0, rtErr); !strings.Contains(note, dir) {
+		t.Errorf("expected a reproducer in %s, got %q", dir, note)
+	}
+	if note := newHarness(t).writeArtifact([]byte("input"), 0, rtErr); note != "" {
+		t.Errorf("expected no reproducer without an artifact directory, got %q", note)
+	}
+}
+
+func TestHarnessCodecFactory(t *testing.T) {
+	pretty := func(h *Harness) bool {
+		for _, info := range h.mediaTypes() {
+			if info.MediaType == runtime.ContentTypeJSON {
+				return info.PrettySerializer != nil
+			}
+		}
+		return false
+	}
+	if !pretty(newHarness(t)) {
+		t.Error("expected the default codec factory to have a pretty JSON serializer")
+	}
+	h := newHarness(t, WithCodecFactory(serializer.NewCodecFactory(runtime.NewScheme(), serializer.DisablePretty)))
+	if pretty(h) {
+		t.Error("expected the codec factory of the harness to be round tripped through")
+	}
+}
+
+func TestHarnessRawExtensionCodecFactory(t *testing.T) {
+	generate := func(h *Harness) (raw *runtime.RawExtension, panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		raw = &runtime.RawExtension{}
+		generateValue(h.newConsumer([]byte{0, 1}), reflect.ValueOf(raw).Elem(), 0)
+		return raw, false
+	}
+	if raw, panicked := generate(newHarness(t, WithKubernetesFuzzerFuncs())); panicked || len(raw.Raw) == 0 {
+		t.Errorf("expected the default codec to encode meta.k8s.io types, got %q", raw.Raw)
+	}
+	// the codec factory is used even if it is set after the fuzzer funcs
+	h := newHarness(t, WithKubernetesFuzzerFuncs(), WithRawExtensionCodecFactory(serializer.NewCodecFactory(runtime.NewScheme())))
+	if _, panicked := generate(h); !panicked {
+		t.Error("expected the codec factory of the harness to be used")
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var (
+	// defaultKinds lists the kinds of Scheme for the package level
+	// functions, whose harness is built on every call.
+	defaultKindsLock   sync.Mutex
+	defaultKindsScheme *runtime.Scheme
+	defaultKinds       *kindsCache
+)
+
+// Reasons reported by SkippedKinds.
+const (
+	SkipReasonInternalVersion   = "internal version"
+	SkipReasonNonRoundTrippable = "listed as non round trippable"
+	SkipReasonNotInstantiable   = "cannot be instantiated by the scheme"
+	SkipReasonNoTypeMeta        = "does not embed TypeMeta"
+)
+
+// SkippedKind is a kind registered in a scheme that is not round tripped.
+type SkippedKind struct {
+	GVK    schema.GroupVersionKind
+	Reason string
+}
+
+// kindList holds the sorted kinds of a scheme that can be round tripped and
+// the ones that were skipped.
+type kindList struct {
+	kinds       []schema.GroupVersionKind
+	convertible []schema.GroupVersionKind
+	skipped     []SkippedKind
+}
+
+// kindsCache holds the kindList of a harness, built on first use.
+type kindsCache struct {
+	once sync.Once
+	list *kindList
+}
+
+// defaultKindsOf returns the kindsCache of the package level functions for
+// scheme, a new one if Scheme was replaced.
+func defaultKindsOf(scheme *runtime.Scheme) *kindsCache {
+	defaultKindsLock.Lock()
+	defer defaultKindsLock.Unlock()
+	if defaultKinds == nil || defaultKindsScheme != scheme {
+		defaultKindsScheme, defaultKinds = scheme, &kindsCache{}
+	}
+	return defaultKinds
+}
+
+// RoundTrippableKinds returns the kinds of Scheme that ExternalTypesViaJSON
+// selects from, in selection order.
+func RoundTrippableKinds() []schema.GroupVersionKind {
+	return defaultHarness().RoundTrippableKinds()
+}
+
+// SkippedKinds returns the kinds of Scheme that are never round tripped,
+// together with the reason they were skipped.
+func SkippedKinds() []SkippedKind {
+	return defaultHarness().SkippedKinds()
+}
+
+// ConvertibleKinds returns the kinds of Scheme that InternalTypesViaJSON
+// selects from, in selection order. These are the round trippable kinds with
+// a registered internal version.
+func ConvertibleKinds() []schema.GroupVersionKind {
+	return defaultHarness().ConvertibleKinds()
+}
+
+// RoundTrippableKinds returns the kinds that h.ExternalTypesViaJSON selects
+// from, in selection order.
+func (h *Harness) RoundTrippableKinds() []schema.GroupVersionKind {
+	return append([]schema.GroupVersionKind(nil), h.roundTrippableKinds()...)
+}
+
+// SkippedKinds returns the kinds of the scheme of h that are never round
+// tripped, together with the reason they were skipped.
+func (h *Harness) SkippedKinds() []SkippedKind {
+	return append([]SkippedKind(nil), h.kindList().skipped...)
+}
+
+// ConvertibleKinds returns the kinds that h.InternalTypesViaJSON selects
+// from, in selection order.
+func (h *Harness) ConvertibleKinds() []schema.GroupVersionKind {
+	return append([]schema.GroupVersionKind(nil), h.convertibleKinds()...)
+}
+
+// roundTrippableKinds returns the kinds of the scheme of h that can be round
+// tripped, sorted by group, version and kind so that a kind selector always
+// picks the same kind for a given scheme.
+func (h *Harness) roundTrippableKinds() []schema.GroupVersionKind {
+	return h.kindList().kinds
+}
+
+// convertibleKinds returns the round trippable kinds that have an internal
+// version, in the same order as roundTrippableKinds.
+func (h *Harness) convertibleKinds() []schema.GroupVersionKind {
+	return h.kindList().convertible
+}
+
+// kindList returns the kinds of the scheme of h, listed on first use.
+func (h *Harness) kindList() *kindList {
+	h.kinds.once.Do(func() {
+		h.kinds.list = kindsOf(h.scheme, h.skip)
+	})
+	return h.kinds.list
+}
+
+// kindsOf sorts the kinds of scheme into round trippable and skipped ones,
+// skipping the kinds in skip.
+func kindsOf(scheme *runtime.Scheme, skip sets.String) *kindList {
+	known := scheme.AllKnownTypes()
+	l := &kindList{}
+	for gvk := range known {
+		if reason := skipReason(scheme, skip, gvk); len(reason) != 0 {
+			l.skipped = append(l.skipped, SkippedKind{GVK: gvk, Reason: reason})
+			continue
+		}
+		l.kinds = append(l.kinds, gvk)
+	}
+	sort.Slice(l.kinds, func(i, j int) bool {
+		return lessGVK(l.kinds[i], l.kinds[j])
+	})
+	sort.Slice(l.skipped, func(i, j int) bool {
+		return lessGVK(l.skipped[i].GVK, l.skipped[j].GVK)
+	})
+	for _, gvk := range l.kinds {
+		if hasInternalVersion(known, gvk) {
+			l.convertible = append(l.convertible, gvk)
+		}
+	}
+	return l
+}
+
+// skipReason returns why gvk can't be round tripped, or an empty string if
+// it can.
+func skipReason(scheme *runtime.Scheme, skip sets.String, gvk schema.GroupVersionKind) string {
+	if gvk.Version == runtime.APIVersionInternal {
+		return SkipReasonInternalVersion
+	}
+	if skip.Has(gvk.Kind) {
+		return SkipReasonNonRoundTrippable
+	}
+	object, err := scheme.New(gvk)
+	if err != nil {
+		return SkipReasonNotInstantiable
+	}
+	if _, err := apimeta.TypeAccessor(object); err != nil {
+		return SkipReasonNoTypeMeta
+	}
+	return ""
+}
+
+// hasInternalVersion reports whether gvk has an internal version of a
+// different type that it can be converted to.
+func hasInternalVersion(known map[schema.GroupVersionKind]reflect.Type, gvk schema.GroupVersionKind) bool {
+	internal, ok := known[gvk.GroupKind().WithVersion(runtime.APIVersionInternal)]
+	return ok && internal != known[gvk]
+}
+
+func lessGVK(a, b schema.GroupVersionKind) bool {
+	if a.Group != b.Group {
+		return a.Group < b.Group
+	}
+	if a.Version != b.Version {
+		return a.Version < b.Version
+	}
+	return a.Kind < b.Kind
+}
+
+// selectKind maps a fuzzer provided selector onto kinds. Negative selectors
+// are valid so that any int produced by a fuzzing engine selects a kind.
+func selectKind(kinds []schema.GroupVersionKind, typeToTest int) schema.GroupVersionKind {
+	index := typeToTest % len(kinds)
+	if index < 0 {
+		index += len(kinds)
+	}
+	return kinds[index]
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRoundTrippableKindsAreSorted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := newHarness(t, WithScheme(scheme)).roundTrippableKinds()
+	if len(kinds) == 0 {
+		t.Fatal("expected round trippable kinds")
+	}
+	if !sort.SliceIsSorted(kinds, func(i, j int) bool { return lessGVK(kinds[i], kinds[j]) }) {
+		t.Errorf("kinds are not sorted: %v", kinds)
+	}
+	for _, gvk := range kinds {
+		if gvk.Version == runtime.APIVersionInternal || globalNonRoundTrippableTypes.Has(gvk.Kind) {
+			t.Errorf("%v should not be round tripped", gvk)
+		}
+	}
+
+	// a scheme with the same types lists the same kinds
+	other := runtime.NewScheme()
+	if err := corev1.AddToScheme(other); err != nil {
+		t.Fatal(err)
+	}
+	otherKinds := newHarness(t, WithScheme(other)).roundTrippableKinds()
+	for typeToTest := -len(kinds); typeToTest < 2*len(kinds); typeToTest++ {
+		if a, b := selectKind(kinds, typeToTest), selectKind(otherKinds, typeToTest); a != b {
+			t.Errorf("selector %d picked %v and %v", typeToTest, a, b)
+		}
+	}
+}
+
+func TestSkippedKinds(t *testing.T) {
+	skipped := make(map[string]string)
+	for _, s := range SkippedKinds() {
+		skipped[s.GVK.String()] = s.Reason
+	}
+	for _, gvk := range RoundTrippableKinds() {
+		if reason, ok := skipped[gvk.String()]; ok {
+			t.Errorf("%v is both round tripped and skipped (%s)", gvk, reason)
+		}
+	}
+
+	watchEvent := corev1.SchemeGroupVersion.WithKind("WatchEvent")
+	if reason := skipped[watchEvent.String()]; reason != SkipReasonNonRoundTrippable {
+		t.Errorf("expected %v to be skipped as %q, got %q", watchEvent, SkipReasonNonRoundTrippable, reason)
+	}
+	internalEvent := watchEvent.GroupKind().WithVersion(runtime.APIVersionInternal)
+	if reason := skipped[internalEvent.String()]; reason != SkipReasonInternalVersion {
+		t.Errorf("expected %v to be skipped as %q, got %q", internalEvent, SkipReasonInternalVersion, reason)
+	}
+}
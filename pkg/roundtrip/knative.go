@@ -0,0 +1,72 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	fuzz "github.com/AdaLogics/go-fuzz-headers"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// knativeConditions are the conditions FuzzConditions fills in for the duck
+// types, like the fuzzer of knative.dev/pkg/apis/duck/v1/test does.
+var knativeConditions = apis.Conditions{{Type: apis.ConditionReady}, {Type: apis.ConditionSucceeded}}
+
+// InstallKnativeDuckTypes registers the duck types of knative.dev/pkg/apis/duck/v1
+// (KResource, AddressableType, Source, WithPod and Binding, and their lists)
+// with scheme. It changes nothing else: a harness for them also needs
+// WithKnativeFuzzerFuncs and WithKnativeCmpOptions. The duck types embed core
+// types such as PodSpec, so use InstallKubernetesAPIs and
+// WithKubernetesFuzzerFuncs too.
+func InstallKnativeDuckTypes(scheme *runtime.Scheme) error {
+	return duckv1.AddToScheme(scheme)
+}
+
+// WithKnativeFuzzerFuncs adds KnativeFuzzerFuncs with PresetPriority, so that
+// funcs added with WithFuncs override them.
+func WithKnativeFuzzerFuncs() HarnessOption {
+	return WithFuncsPriority(PresetPriority, KnativeFuzzerFuncs())
+}
+
+// WithKnativeCmpOptions adds KnativeCmpOpts to the options for diffs.
+func WithKnativeCmpOptions() HarnessOption {
+	return WithCmpOptions(KnativeCmpOpts()...)
+}
+
+// KnativeFuzzerFuncs returns FuzzerFuncs plus a func that keeps the
+// conditions of duck typed statuses to the known condition types.
+func KnativeFuzzerFuncs() []interface{} {
+	return append(FuzzerFuncs(),
+		func(status *duckv1.Status, c fuzz.Continue) error {
+			if err := generateNoCustom(c, status); err != nil {
+				return err
+			}
+			status.SetConditions(knativeConditions.DeepCopy())
+			return FuzzConditions(status, c)
+		},
+	)
+}
+
+// KnativeCmpOpts returns the cmp options that make field diffs agree with
+// apiequality.Semantic on Knative types: apis.VolatileTime values are always
+// equal.
+func KnativeCmpOpts() []cmp.Option {
+	return []cmp.Option{
+		cmp.Comparer(func(apis.VolatileTime, apis.VolatileTime) bool { return true }),
+	}
+}
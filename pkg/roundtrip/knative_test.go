@@ -0,0 +1,79 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestInstallKnativeDuckTypes(t *testing.T) {
+	funcTypes, cmpOpts := len(FuncTypes()), len(CmpOpts)
+	scheme := runtime.NewScheme()
+	if err := InstallKnativeDuckTypes(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if len(FuncTypes()) != funcTypes || len(CmpOpts) != cmpOpts {
+		t.Error("expected the package level fuzzer funcs and cmp options to be left alone")
+	}
+	for _, kind := range []string{"KResource", "AddressableType", "Source", "WithPod", "Binding"} {
+		if gvk := duckv1.SchemeGroupVersion.WithKind(kind); !scheme.Recognizes(gvk) {
+			t.Errorf("%v is not registered", gvk)
+		}
+	}
+
+	// transition times are volatile, so statuses that only differ in them
+	// are equal
+	x := &duckv1.KResource{Status: duckv1.Status{Conditions: duckv1.Conditions{{
+		Type:               apis.ConditionReady,
+		LastTransitionTime: apis.VolatileTime{Inner: metav1.NewTime(time.Unix(1, 0))},
+	}}}}
+	y := x.DeepCopy()
+	y.Status.Conditions[0].LastTransitionTime = apis.VolatileTime{Inner: metav1.NewTime(time.Unix(2, 0))}
+	h := newHarness(t, WithScheme(scheme), WithKnativeFuzzerFuncs(), WithKnativeCmpOptions())
+	if paths, diff := h.fieldDiffs(x, y); len(paths) != 0 {
+		t.Errorf("expected no diff, got:\n%s", diff)
+	}
+	if _, _, ok := h.funcs.Lookup(reflect.TypeOf(&duckv1.Status{})); !ok {
+		t.Error("expected a fuzzer func for duckv1.Status")
+	}
+
+	// the duck types round trip
+	if err := InstallKubernetesAPIs(scheme); err != nil {
+		t.Fatal(err)
+	}
+	h = newHarness(t, WithScheme(scheme), WithKubernetesFuzzerFuncs(), WithKnativeFuzzerFuncs(), WithKnativeCmpOptions())
+	r := rand.New(rand.NewSource(1))
+	for typeToTest, gvk := range h.RoundTrippableKinds() {
+		if gvk.GroupVersion() != duckv1.SchemeGroupVersion {
+			continue
+		}
+		for i := 0; i < 8; i++ {
+			data := make([]byte, r.Intn(4096))
+			r.Read(data)
+			if err := h.ExternalTypesViaJSON(data, typeToTest); err != nil {
+				t.Errorf("%v: %v", gvk, err)
+			}
+		}
+	}
+}
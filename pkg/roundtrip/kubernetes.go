@@ -0,0 +1,180 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	apidiscoveryv2beta1 "k8s.io/api/apidiscovery/v2beta1"
+	apiserverinternalv1alpha1 "k8s.io/api/apiserverinternal/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1alpha1 "k8s.io/api/authentication/v1alpha1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	authorizationv1beta1 "k8s.io/api/authorization/v1beta1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	eventsv1 "k8s.io/api/events/v1"
+	eventsv1beta1 "k8s.io/api/events/v1beta1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	flowcontrolv1alpha1 "k8s.io/api/flowcontrol/v1alpha1"
+	flowcontrolv1beta1 "k8s.io/api/flowcontrol/v1beta1"
+	flowcontrolv1beta2 "k8s.io/api/flowcontrol/v1beta2"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	imagepolicyv1alpha1 "k8s.io/api/imagepolicy/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	networkingv1alpha1 "k8s.io/api/networking/v1alpha1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	nodev1 "k8s.io/api/node/v1"
+	nodev1alpha1 "k8s.io/api/node/v1alpha1"
+	nodev1beta1 "k8s.io/api/node/v1beta1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	rbacv1alpha1 "k8s.io/api/rbac/v1alpha1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	resourcev1alpha1 "k8s.io/api/resource/v1alpha1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	schedulingv1alpha1 "k8s.io/api/scheduling/v1alpha1"
+	schedulingv1beta1 "k8s.io/api/scheduling/v1beta1"
+	storagev1 "k8s.io/api/storage/v1"
+	storagev1alpha1 "k8s.io/api/storage/v1alpha1"
+	storagev1beta1 "k8s.io/api/storage/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// kubernetesAddToScheme registers every group and version of k8s.io/api,
+// plus the meta.k8s.io types.
+var kubernetesAddToScheme = runtime.SchemeBuilder{
+	admissionv1.AddToScheme,
+	admissionv1beta1.AddToScheme,
+	admissionregistrationv1.AddToScheme,
+	admissionregistrationv1alpha1.AddToScheme,
+	admissionregistrationv1beta1.AddToScheme,
+	apidiscoveryv2beta1.AddToScheme,
+	apiserverinternalv1alpha1.AddToScheme,
+	appsv1.AddToScheme,
+	appsv1beta1.AddToScheme,
+	appsv1beta2.AddToScheme,
+	authenticationv1.AddToScheme,
+	authenticationv1alpha1.AddToScheme,
+	authenticationv1beta1.AddToScheme,
+	authorizationv1.AddToScheme,
+	authorizationv1beta1.AddToScheme,
+	autoscalingv1.AddToScheme,
+	autoscalingv2.AddToScheme,
+	autoscalingv2beta1.AddToScheme,
+	autoscalingv2beta2.AddToScheme,
+	batchv1.AddToScheme,
+	batchv1beta1.AddToScheme,
+	certificatesv1.AddToScheme,
+	certificatesv1beta1.AddToScheme,
+	coordinationv1.AddToScheme,
+	coordinationv1beta1.AddToScheme,
+	corev1.AddToScheme,
+	discoveryv1.AddToScheme,
+	discoveryv1beta1.AddToScheme,
+	eventsv1.AddToScheme,
+	eventsv1beta1.AddToScheme,
+	extensionsv1beta1.AddToScheme,
+	flowcontrolv1alpha1.AddToScheme,
+	flowcontrolv1beta1.AddToScheme,
+	flowcontrolv1beta2.AddToScheme,
+	flowcontrolv1beta3.AddToScheme,
+	imagepolicyv1alpha1.AddToScheme,
+	networkingv1.AddToScheme,
+	networkingv1alpha1.AddToScheme,
+	networkingv1beta1.AddToScheme,
+	nodev1.AddToScheme,
+	nodev1alpha1.AddToScheme,
+	nodev1beta1.AddToScheme,
+	policyv1.AddToScheme,
+	policyv1beta1.AddToScheme,
+	rbacv1.AddToScheme,
+	rbacv1alpha1.AddToScheme,
+	rbacv1beta1.AddToScheme,
+	resourcev1alpha1.AddToScheme,
+	schedulingv1.AddToScheme,
+	schedulingv1alpha1.AddToScheme,
+	schedulingv1beta1.AddToScheme,
+	storagev1.AddToScheme,
+	storagev1alpha1.AddToScheme,
+	storagev1beta1.AddToScheme,
+	metav1.AddMetaToScheme,
+	metav1beta1.AddMetaToScheme,
+}
+
+// InstallKubernetesAPIs registers every group and version of k8s.io/api and
+// the meta.k8s.io/v1 and meta.k8s.io/v1beta1 types with scheme. It changes
+// nothing else; the fuzzer funcs for these types come with
+// WithKubernetesFuzzerFuncs. A full Kubernetes round trip fuzzer is then:
+//
+//	func FuzzKubernetes(f *testing.F) {
+//	  scheme := runtime.NewScheme()
+//	  if err := roundtrip.InstallKubernetesAPIs(scheme); err != nil {
+//	    f.Fatal(err)
+//	  }
+//	  h, err := roundtrip.NewHarness(roundtrip.WithScheme(scheme), roundtrip.WithKubernetesFuzzerFuncs())
+//	  if err != nil {
+//	    f.Fatal(err)
+//	  }
+//	  h.Fuzz(f)
+//	}
+func InstallKubernetesAPIs(scheme *runtime.Scheme) error {
+	return kubernetesAddToScheme.AddToScheme(scheme)
+}
+
+// WithKubernetesFuzzerFuncs adds KubernetesFuzzerFuncs with PresetPriority,
+// so that funcs added with WithFuncs override them. Their RawExtensions are
+// encoded with the codec factory of the harness, see
+// WithRawExtensionCodecFactory.
+func WithKubernetesFuzzerFuncs() HarnessOption {
+	return func(h *Harness) error {
+		return h.funcs.Add(PresetPriority, kubernetesFuzzerFuncs(h.rawExtensionCodec))
+	}
+}
+
+// KubernetesFuzzerFuncs returns the fuzzer funcs for the types of
+// k8s.io/api: V1FuzzerFuncs, V1beta1FuzzerFuncs and GenericFuzzerFuncs.
+func KubernetesFuzzerFuncs() []interface{} {
+	return kubernetesFuzzerFuncs(rawExtensionCodec)
+}
+
+func kubernetesFuzzerFuncs(rawCodec func() runtime.Codec) []interface{} {
+	var funcs []interface{}
+	funcs = append(funcs, V1FuzzerFuncs()...)
+	funcs = append(funcs, V1beta1FuzzerFuncs()...)
+	return append(funcs, genericFuzzerFuncs(rawCodec)...)
+}
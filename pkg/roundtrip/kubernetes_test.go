@@ -0,0 +1,65 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	fuzz "github.com/AdaLogics/go-fuzz-headers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestInstallKubernetesAPIs(t *testing.T) {
+	funcTypes := len(FuncTypes())
+	scheme := runtime.NewScheme()
+	if err := InstallKubernetesAPIs(scheme); err != nil {
+		t.Fatal(err)
+	}
+	for _, gvk := range []schema.GroupVersionKind{
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "flowcontrol.apiserver.k8s.io", Version: "v1beta3", Kind: "FlowSchema"},
+		{Group: "resource.k8s.io", Version: "v1alpha1", Kind: "ResourceClaim"},
+		{Group: "meta.k8s.io", Version: "v1", Kind: "Table"},
+		{Group: "meta.k8s.io", Version: "v1beta1", Kind: "PartialObjectMetadata"},
+	} {
+		if !scheme.Recognizes(gvk) {
+			t.Errorf("%v is not registered", gvk)
+		}
+	}
+	if n := len(newHarness(t, WithScheme(scheme)).roundTrippableKinds()); n < 300 {
+		t.Errorf("expected hundreds of round trippable kinds, got %d", n)
+	}
+	if types := FuncTypes(); len(types) != funcTypes {
+		t.Errorf("expected the package level fuzzer funcs to be left alone, got %v", types)
+	}
+
+	h := newHarness(t, WithScheme(scheme), WithKubernetesFuzzerFuncs(), WithFuncs([]interface{}{
+		func(j *metav1.ObjectMeta, c fuzz.Continue) error { return nil },
+	}))
+	if _, priority, ok := h.funcs.Lookup(reflect.TypeOf(&metav1.Time{})); !ok || priority != PresetPriority {
+		t.Errorf("expected a preset fuzzer func for metav1.Time, got %v with priority %d", ok, priority)
+	}
+	pod := &corev1.Pod{}
+	h.fuzzInternalObject(bytes.Repeat([]byte{1, 2, 3}, 64), pod)
+	if pod.Name != "" {
+		t.Errorf("expected the ObjectMeta func of WithFuncs to override the preset, got %q", pod.Name)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	gfh "github.com/AdaLogics/go-fuzz-headers"
+	"github.com/google/go-cmp/cmp"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fuzzManagedFields replaces the FieldsV1 of every managed fields entry of
+// object with a field set built from the fields object actually has. ff
+// decides which fields are part of each set; once it runs out of data every
+// field is.
+func fuzzManagedFields(ff *gfh.ConsumeFuzzer, object runtime.Object) {
+	accessor, err := apimeta.Accessor(object)
+	if err != nil {
+		return
+	}
+	entries := accessor.GetManagedFields()
+	if len(entries) == 0 {
+		return
+	}
+
+	content, err := managedFieldsContent(object)
+	if err != nil {
+		return
+	}
+
+	for i := range entries {
+		raw, err := json.Marshal(fieldSet(ff, content))
+		if err != nil {
+			continue
+		}
+		entries[i].FieldsType = "FieldsV1"
+		entries[i].FieldsV1 = &metav1.FieldsV1{Raw: raw}
+	}
+	accessor.SetManagedFields(entries)
+}
+
+// managedFieldsContent returns the fields of object that managed fields
+// entries can own.
+func managedFieldsContent(object runtime.Object) (map[string]interface{}, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "apiVersion")
+	delete(content, "kind")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "managedFields")
+	}
+	return content, nil
+}
+
+// fieldSet returns the FieldsV1 representation of a subset of fields.
+func fieldSet(ff *gfh.ConsumeFuzzer, fields map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := make(map[string]interface{})
+	for _, key := range keys {
+		if !isPlainFieldsText(key) || !includeField(ff) {
+			continue
+		}
+		set["f:"+key] = fieldSetOf(ff, fields[key])
+	}
+	return set
+}
+
+func fieldSetOf(ff *gfh.ConsumeFuzzer, value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return fieldSet(ff, v)
+	case []interface{}:
+		set := make(map[string]interface{})
+		for i, item := range v {
+			key, ok := listItemKey(item, i)
+			if !ok || !includeField(ff) {
+				continue
+			}
+			child := fieldSetOf(ff, item)
+			if len(child) != 0 {
+				child["."] = map[string]interface{}{}
+			}
+			set[key] = child
+		}
+		return set
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// listItemKey returns the key of a list item: k: for items with a name,
+// v: for scalars and i: for everything else.
+func listItemKey(item interface{}, index int) (string, bool) {
+	switch v := item.(type) {
+	case map[string]interface{}:
+		name, ok := v["name"].(string)
+		if !ok {
+			return "i:" + strconv.Itoa(index), true
+		}
+		key, err := json.Marshal(map[string]string{"name": name})
+		if err != nil || !isPlainFieldsText(string(key)) {
+			return "", false
+		}
+		return "k:" + string(key), true
+	case []interface{}:
+		return "i:" + strconv.Itoa(index), true
+	default:
+		value, err := json.Marshal(v)
+		if err != nil || !isPlainFieldsText(string(value)) {
+			return "", false
+		}
+		return "v:" + string(value), true
+	}
+}
+
+// isPlainFieldsText reports whether s only has characters that every
+// serializer writes the same way. Encoders escape HTML and non-printable
+// characters differently, and FieldsV1 has to survive byte for byte.
+func isPlainFieldsText(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e || r == '<' || r == '>' || r == '&' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeManagedFields writes the input that makes fuzzManagedFields generate
+// the FieldsV1 of the managed fields entries of object.
+func (e *inputEncoder) encodeManagedFields(object runtime.Object) error {
+	accessor, err := apimeta.Accessor(object)
+	if err != nil {
+		return nil
+	}
+	entries := accessor.GetManagedFields()
+	if len(entries) == 0 {
+		return nil
+	}
+	content, err := managedFieldsContent(object)
+	if err != nil {
+		return nil
+	}
+
+	for i, entry := range entries {
+		var set map[string]interface{}
+		if entry.FieldsType != "FieldsV1" || entry.FieldsV1 == nil || json.Unmarshal(entry.FieldsV1.Raw, &set) != nil {
+			return fmt.Errorf("managed fields entry %d has no FieldsV1 that fuzzManagedFields generates", i)
+		}
+		if err := e.encodeFieldSet(content, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeFieldSet is the inverse of fieldSet.
+func (e *inputEncoder) encodeFieldSet(fields, set map[string]interface{}) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !isPlainFieldsText(key) {
+			continue
+		}
+		child, include := set["f:"+key].(map[string]interface{})
+		if err := e.writeInclude(include); err != nil {
+			return err
+		}
+		if include {
+			if err := e.encodeFieldSetOf(fields[key], child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeFieldSetOf is the inverse of fieldSetOf.
+func (e *inputEncoder) encodeFieldSetOf(value interface{}, set map[string]interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return e.encodeFieldSet(v, set)
+	case []interface{}:
+		// items with the same key replace each other, so the last item
+		// that has the fields in set is included as in set, the items
+		// before it whole as they are once the input runs out, and the
+		// items after it not at all
+		carrier := make(map[string]int, len(v))
+		for i, item := range v {
+			key, ok := listItemKey(item, i)
+			if !ok {
+				continue
+			}
+			child, include := set[key].(map[string]interface{})
+			if _, found := carrier[key]; include && (!found || hasFields(item, child)) {
+				carrier[key] = i
+			}
+		}
+		for i, item := range v {
+			key, ok := listItemKey(item, i)
+			if !ok {
+				continue
+			}
+			child, include := set[key].(map[string]interface{})
+			if include && i < carrier[key] {
+				child = fieldSetOf(gfh.NewConsumer(nil), item)
+			}
+			include = include && i <= carrier[key]
+			if err := e.writeInclude(include); err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+			withoutSelf := make(map[string]interface{}, len(child))
+			for k, c := range child {
+				if k != "." {
+					withoutSelf[k] = c
+				}
+			}
+			if err := e.encodeFieldSetOf(item, withoutSelf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasFields reports whether item has the fields of its field set.
+func hasFields(item interface{}, set map[string]interface{}) bool {
+	fields := fieldSetOf(gfh.NewConsumer(nil), item)
+	for key := range set {
+		if _, ok := fields[key]; !ok && key != "." {
+			return false
+		}
+	}
+	return true
+}
+
+func includeField(ff *gfh.ConsumeFuzzer) bool {
+	include, err := ff.GetBool()
+	return err != nil || include
+}
+
+// checkManagedFields round trips object through codec and checks that the
+// FieldsV1 of every managed fields entry is unchanged, byte for byte.
+func checkManagedFields(gvk schema.GroupVersionKind, mediaType string, codec runtime.Codec, object runtime.Object) error {
+	accessor, err := apimeta.Accessor(object)
+	if err != nil || len(accessor.GetManagedFields()) == 0 {
+		return nil
+	}
+	data, err := runtime.Encode(codec, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+	decoded, err := runtime.Decode(codec, data)
+	if err != nil {
+		return nil
+	}
+	decodedAccessor, err := apimeta.Accessor(decoded)
+	if err != nil {
+		return nil
+	}
+
+	before, after := accessor.GetManagedFields(), decodedAccessor.GetManagedFields()
+	for i := range before {
+		var beforeRaw, afterRaw []byte
+		if before[i].FieldsV1 != nil {
+			beforeRaw = before[i].FieldsV1.Raw
+		}
+		if i < len(after) && after[i].FieldsV1 != nil {
+			afterRaw = after[i].FieldsV1.Raw
+		}
+		if i >= len(after) || !bytes.Equal(beforeRaw, afterRaw) {
+			return &RoundTripError{
+				GVK:      gvk,
+				Codec:    mediaType,
+				Stage:    StageManagedFields,
+				Original: object,
+				Decoded:  decoded,
+				Data:     data,
+				Fields:   []string{fmt.Sprintf("metadata.managedFields[%d].fieldsV1", i)},
+				Diff:     cmp.Diff(string(beforeRaw), string(afterRaw)),
+			}
+		}
+	}
+	return nil
+}
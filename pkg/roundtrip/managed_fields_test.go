@@ -0,0 +1,66 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"testing"
+
+	gfh "github.com/AdaLogics/go-fuzz-headers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+)
+
+func TestFuzzManagedFields(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "fuzz",
+			Labels:        map[string]string{"app": "fuzz", "a&b": "c"},
+			Finalizers:    []string{"a", "b"},
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "fuzzer"}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "first", Image: "busybox", Args: []string{"-v"}},
+		}},
+	}
+	// an empty consumer includes every field
+	fuzzManagedFields(gfh.NewConsumer(nil), pod)
+
+	fieldsV1 := pod.ManagedFields[0].FieldsV1
+	if fieldsV1 == nil {
+		t.Fatal("expected FieldsV1 to be set")
+	}
+	set := &fieldpath.Set{}
+	if err := set.FromJSON(bytes.NewReader(fieldsV1.Raw)); err != nil {
+		t.Fatalf("invalid FieldsV1 %s: %v", fieldsV1.Raw, err)
+	}
+	for _, expected := range []string{`"k:{\"name\":\"first\"}"`, `"v:\"a\""`, `"f:app"`} {
+		if !bytes.Contains(fieldsV1.Raw, []byte(expected)) {
+			t.Errorf("expected %s in %s", expected, fieldsV1.Raw)
+		}
+	}
+	if bytes.Contains(fieldsV1.Raw, []byte("managedFields")) || bytes.Contains(fieldsV1.Raw, []byte("a&b")) {
+		t.Errorf("unexpected fields in %s", fieldsV1.Raw)
+	}
+
+	gvk := corev1.SchemeGroupVersion.WithKind("Pod")
+	for _, info := range defaultHarness().mediaTypes() {
+		if err := checkManagedFields(gvk, info.MediaType, info.Serializer, pod); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
@@ -47,7 +47,7 @@ func V1FuzzerFuncs() []interface{} {
 		},
 		func(j *metav1.ObjectMeta, c fuzz.Continue) error {
 			//fmt.Println("Creating ObjectMeta...")
-			c.GenerateStruct(j)
+			generateNoCustom(c, j)
 
 			j.ResourceVersion = "123456789"
 			ri, err := c.F.GetInt()
@@ -168,7 +168,7 @@ func V1FuzzerFuncs() []interface{} {
 			return nil
 		},
 		func(j *metav1.LabelSelector, c fuzz.Continue) error {
-			c.GenerateStruct(j)
+			generateNoCustom(c, j)
 			var length, ind int
 			var randLabel, labelKey, l string
 			var err error
@@ -252,7 +252,9 @@ func V1FuzzerFuncs() []interface{} {
 			return nil
 		},
 		func(j *metav1.ManagedFieldsEntry, c fuzz.Continue) error {
-			c.GenerateStruct(j)
+			generateNoCustom(c, j)
+			// FieldsV1 is generated from the whole object once it has
+			// been fuzzed, see fuzzManagedFields.
 			j.FieldsV1 = nil
 			return nil
 		},
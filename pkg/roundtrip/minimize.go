@@ -0,0 +1,286 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// maxMinimizePasses bounds the number of passes over an object's fields.
+// Every pass but the last one removes at least one field.
+const maxMinimizePasses = 16
+
+// Minimized is a failing round trip reduced by Minimize: an input for the
+// fuzzer, and the object it generates for a regression test.
+type Minimized struct {
+	// GVK is the kind that fails.
+	GVK schema.GroupVersionKind
+	// Stage is the stage Input and Object fail at.
+	Stage Stage
+	// Input is the smallest input found that makes ExternalTypesViaJSON
+	// fail at Stage with the same selector.
+	Input []byte
+	// InputErr is the failure of ExternalTypesViaJSON with Input.
+	InputErr *RoundTripError
+	// Object is the object generated from Input, with its TypeMeta set.
+	Object runtime.Object
+	// Err is the failure of a round trip of Object.
+	Err *RoundTripError
+}
+
+// Minimize reduces an input that makes ExternalTypesViaJSON(data, typeToTest)
+// fail. It first removes bytes from data while the failure stage stays the
+// same, then regenerates the object from what is left and zeroes its fields
+// one by one. It keeps every change after which an input that generates the
+// changed object still fails at the same stage. Values generated by fuzzer
+// funcs are only kept as generated or removed as a whole, since their input
+// is only known for what the fuzzer funcs generated. It returns an error if
+// data doesn't fail a round trip.
+func Minimize(data []byte, typeToTest int) (*Minimized, error) {
+	return defaultHarness().Minimize(data, typeToTest)
+}
+
+// Minimize is like the package level Minimize, for the kinds of the scheme of
+// h.
+func (h *Harness) Minimize(data []byte, typeToTest int) (*Minimized, error) {
+	// the same input is round tripped over and over, which says nothing
+	// about the campaign
+	h = h.withoutStats()
+	kinds := h.roundTrippableKinds()
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no round trippable kinds are registered in the scheme")
+	}
+	gvk := selectKind(kinds, typeToTest)
+
+	inputErr := h.inputError(data, typeToTest)
+	if inputErr == nil {
+		return nil, fmt.Errorf("input does not fail a round trip of %v", gvk)
+	}
+	stage := inputErr.Stage
+	reproduces := func(candidate []byte) bool {
+		rtErr := h.inputError(candidate, typeToTest)
+		return rtErr != nil && rtErr.Stage == stage
+	}
+	input := minimizeInput(data, reproduces)
+
+	// record the input of the fuzzer funcs, so that the input of every
+	// smaller object can be written
+	ff, calls := h.recordingConsumer(input)
+	generated, err := h.scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	generateObject(ff, generated)
+	object := generated.DeepCopyObject()
+	if err := setTypeMeta(object, gvk); err != nil {
+		return nil, err
+	}
+	minimizeObject(object, func() bool {
+		candidate, err := encodeObject(ff.Funcs, *calls, object)
+		if err != nil {
+			return false
+		}
+		regenerated, err := h.generateExternal(gvk, candidate)
+		if err != nil || !apiequality.Semantic.DeepEqual(regenerated, object) || !reproduces(candidate) {
+			return false
+		}
+		input = candidate
+		return true
+	})
+
+	object, err = h.generateExternal(gvk, input)
+	if err != nil {
+		return nil, err
+	}
+	return &Minimized{
+		GVK:      gvk,
+		Stage:    stage,
+		Input:    input,
+		InputErr: h.inputError(input, typeToTest),
+		Object:   object,
+		Err:      h.objectError(gvk, object),
+	}, nil
+}
+
+// generateExternal generates an object of kind gvk from data, like
+// ExternalTypesViaJSON does.
+func (h *Harness) generateExternal(gvk schema.GroupVersionKind, data []byte) (runtime.Object, error) {
+	object, err := h.scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	h.fuzzInternalObject(data, object)
+	return object, setTypeMeta(object, gvk)
+}
+
+func setTypeMeta(object runtime.Object, gvk schema.GroupVersionKind) error {
+	typeAcc, err := apimeta.TypeAccessor(object)
+	if err != nil {
+		return err
+	}
+	typeAcc.SetKind(gvk.Kind)
+	typeAcc.SetAPIVersion(gvk.GroupVersion().String())
+	return nil
+}
+
+// objectError returns the round trip failure of object, or nil if it doesn't
+// fail a round trip. Panics count as not failing.
+func (h *Harness) objectError(gvk schema.GroupVersionKind, object runtime.Object) (rtErr *RoundTripError) {
+	defer func() {
+		if recover() != nil {
+			rtErr = nil
+		}
+	}()
+	errors.As(h.roundTripObject(gvk, object.DeepCopyObject(), h.mediaTypes()), &rtErr)
+	return rtErr
+}
+
+// inputError returns the round trip failure of ExternalTypesViaJSON, or nil
+// if it doesn't fail a round trip. Panics count as not failing.
+func (h *Harness) inputError(data []byte, typeToTest int) (rtErr *RoundTripError) {
+	defer func() {
+		if recover() != nil {
+			rtErr = nil
+		}
+	}()
+	errors.As(h.ExternalTypesViaJSON(data, typeToTest), &rtErr)
+	return rtErr
+}
+
+// minimizeInput removes ever smaller chunks of data as long as reproduces
+// holds for what is left.
+func minimizeInput(data []byte, reproduces func([]byte) bool) []byte {
+	data = append([]byte(nil), data...)
+	for chunk := len(data) / 2; chunk > 0; chunk /= 2 {
+		for start := 0; start+chunk <= len(data); {
+			candidate := append(append([]byte(nil), data[:start]...), data[start+chunk:]...)
+			if reproduces(candidate) {
+				data = candidate
+				continue
+			}
+			start += chunk
+		}
+	}
+	return data
+}
+
+// minimizeObject zeroes the fields of object, removes slice elements and map
+// entries, as long as reproduces holds for the result. TypeMeta is kept so
+// that the object can still be encoded.
+func minimizeObject(object runtime.Object, reproduces func() bool) {
+	for pass := 0; pass < maxMinimizePasses; pass++ {
+		if !minimizeFields(reflect.ValueOf(object).Elem(), reproduces) {
+			return
+		}
+	}
+}
+
+// minimizeFields minimizes the fields of the struct v and reports whether
+// anything was removed.
+func minimizeFields(v reflect.Value, reproduces func() bool) bool {
+	changed := false
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() || (f.Anonymous && f.Name == "TypeMeta") {
+			continue
+		}
+		if minimizeValue(v.Field(i), reproduces) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// minimizeValue tries to zero v and otherwise minimizes what it holds. It
+// reports whether anything was removed.
+func minimizeValue(v reflect.Value, reproduces func() bool) bool {
+	if v.IsZero() {
+		return false
+	}
+	saved := reflect.New(v.Type()).Elem()
+	saved.Set(v)
+	v.Set(reflect.Zero(v.Type()))
+	if reproduces() {
+		return true
+	}
+	v.Set(saved)
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		return minimizeValue(v.Elem(), reproduces)
+	case reflect.Struct:
+		return minimizeFields(v, reproduces)
+	case reflect.Slice:
+		return minimizeSlice(v, reproduces)
+	case reflect.Map:
+		return minimizeMap(v, reproduces)
+	}
+	return false
+}
+
+func minimizeSlice(v reflect.Value, reproduces func() bool) bool {
+	changed := false
+	for i := v.Len() - 1; i >= 0; i-- {
+		saved := v.Slice(0, v.Len())
+		shorter := reflect.AppendSlice(reflect.MakeSlice(v.Type(), 0, v.Len()-1), v.Slice(0, i))
+		shorter = reflect.AppendSlice(shorter, v.Slice(i+1, v.Len()))
+		v.Set(shorter)
+		if reproduces() {
+			changed = true
+			continue
+		}
+		v.Set(saved)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if minimizeValue(v.Index(i), reproduces) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func minimizeMap(v reflect.Value, reproduces func() bool) bool {
+	changed := false
+	for _, key := range v.MapKeys() {
+		value := v.MapIndex(key)
+		v.SetMapIndex(key, reflect.Value{})
+		if reproduces() {
+			changed = true
+			continue
+		}
+		v.SetMapIndex(key, value)
+
+		// map values aren't addressable, so minimize a copy and store it
+		// before every check
+		elem := reflect.New(value.Type()).Elem()
+		elem.Set(value)
+		if minimizeValue(elem, func() bool {
+			v.SetMapIndex(key, elem)
+			return reproduces()
+		}) {
+			changed = true
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return changed
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+func TestMinimizeObject(t *testing.T) {
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Labels: map[string]string{"a": "b", "c": "d"}},
+		Spec: corev1.PodSpec{
+			Hostname: "host",
+			Containers: []corev1.Container{
+				{Name: "first", Image: "busybox"},
+				{Name: "second", Image: "nginx", Args: []string{"-v"}},
+			},
+		},
+	}
+	// fail as long as a container runs nginx
+	minimizeObject(pod, func() bool {
+		for _, c := range pod.Spec.Containers {
+			if c.Image == "nginx" {
+				return true
+			}
+		}
+		return false
+	})
+
+	want := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		Spec:     corev1.PodSpec{Containers: []corev1.Container{{Image: "nginx"}}},
+	}
+	if paths, diff := defaultHarness().fieldDiffs(want, pod); len(paths) != 0 {
+		t.Errorf("unexpected minimized object:\n%s", diff)
+	}
+}
+
+func TestMinimizeInput(t *testing.T) {
+	data := []byte("some input with a needle in it")
+	got := minimizeInput(data, func(candidate []byte) bool {
+		return bytes.Contains(candidate, []byte("needle"))
+	})
+	if string(got) != "needle" {
+		t.Errorf("expected the input to be reduced to the needle, got %q", got)
+	}
+}
+
+func TestMinimize(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.ConfigMap{})
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, scheme, scheme, false)
+	h := newHarness(t, WithScheme(scheme), WithSerializers(runtime.SerializerInfo{
+		MediaType:  "lossy",
+		Serializer: lossyCodec{Codec: jsonCodec},
+	}))
+
+	// small bytes make short strings, so the input reaches the data
+	r := rand.New(rand.NewSource(1))
+	var data []byte
+	for i := 0; i < 64 && data == nil; i++ {
+		candidate := make([]byte, 1024)
+		r.Read(candidate)
+		for j := range candidate {
+			candidate[j] %= 16
+		}
+		if h.inputError(candidate, 0) != nil {
+			data = candidate
+		}
+	}
+	if data == nil {
+		t.Fatal("no failing input found")
+	}
+
+	h.ResetStats()
+	m, err := h.Minimize(data, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := h.CollectStats().Kinds[kindKey(m.GVK)]; c.Attempts != 0 {
+		t.Errorf("expected minimization not to be counted, got %+v", c)
+	}
+	if len(m.Input) >= len(data) {
+		t.Errorf("expected the input to shrink from %d bytes, got %d", len(data), len(m.Input))
+	}
+
+	// both reproducers fail on their own
+	var rtErr *RoundTripError
+	if !errors.As(h.ExternalTypesViaJSON(m.Input, 0), &rtErr) || rtErr.Stage != m.Stage || m.InputErr == nil || m.InputErr.Stage != m.Stage {
+		t.Errorf("expected the input to fail at %s, got %v and %v", m.Stage, rtErr, m.InputErr)
+	}
+	rtErr = nil
+	if !errors.As(h.roundTripObject(m.GVK, m.Object.DeepCopyObject(), h.mediaTypes()), &rtErr) || rtErr.Stage != m.Stage || m.Err == nil {
+		t.Errorf("expected the object to fail at %s, got %v and %v", m.Stage, rtErr, m.Err)
+	}
+	regenerated, _ := h.fuzzInternalObject(m.Input, &corev1.ConfigMap{})
+	regenerated.GetObjectKind().SetGroupVersionKind(m.GVK)
+	if !apiequality.Semantic.DeepEqual(regenerated, m.Object) {
+		t.Errorf("expected the input to generate the object:\n%s", cmp.Diff(m.Object, regenerated))
+	}
+	if cm := m.Object.(*corev1.ConfigMap); len(cm.Data) != 1 || len(cm.Name) != 0 {
+		t.Errorf("expected a single entry to be left, got %+v", cm)
+	}
+}
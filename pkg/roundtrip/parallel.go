@@ -0,0 +1,81 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	goruntime "runtime"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RunParallel round trips every input as every round trippable kind of
+// Scheme, see Harness.RunParallel.
+func RunParallel(workers int, inputs [][]byte) []*RoundTripError {
+	return defaultHarness().RunParallel(workers, inputs)
+}
+
+// RunParallel round trips every input as every round trippable kind of the
+// scheme of h, spreading the kinds over workers goroutines. If workers is not
+// positive GOMAXPROCS goroutines are used. Inputs that can't be used are
+// ignored. It returns the first failure of every kind that failed, in
+// selection order.
+func (h *Harness) RunParallel(workers int, inputs [][]byte) []*RoundTripError {
+	if workers <= 0 {
+		workers = goruntime.GOMAXPROCS(0)
+	}
+	kinds := h.roundTrippableKinds()
+	serializers := h.mediaTypes()
+	failures := make([]*RoundTripError, len(kinds))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				failures[i] = h.runKind(kinds[i], inputs, serializers)
+			}
+		}()
+	}
+	for i := range kinds {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var errs []*RoundTripError
+	for _, rtErr := range failures {
+		if rtErr != nil {
+			errs = append(errs, rtErr)
+		}
+	}
+	return errs
+}
+
+// runKind round trips every input as gvk and returns the first failure.
+func (h *Harness) runKind(gvk schema.GroupVersionKind, inputs [][]byte, serializers []runtime.SerializerInfo) *RoundTripError {
+	for _, data := range inputs {
+		var rtErr *RoundTripError
+		if errors.As(h.roundTripOfExternalType(data, gvk, serializers), &rtErr) {
+			return rtErr
+		}
+	}
+	return nil
+}
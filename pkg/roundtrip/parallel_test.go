@@ -0,0 +1,53 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRunParallel(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	h := newHarness(t, WithScheme(scheme), WithFuncs(GenericFuzzerFuncs()))
+
+	// registering with the package level functions while harnesses run must
+	// not race with them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			SetCodecFactory(newMetaCodecFactory())
+			defaultHarness()
+		}
+	}()
+	errs := h.RunParallel(4, defaultSeedInputs)
+	wg.Wait()
+
+	for _, err := range errs {
+		t.Error(err)
+	}
+	if c := h.CollectStats().Kinds[kindKey(configMapGVK)]; c.Attempts < int64(len(defaultSeedInputs)) {
+		t.Errorf("expected every input to be round tripped as %v, got %d attempts", configMapGVK, c.Attempts)
+	}
+}
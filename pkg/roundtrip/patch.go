@@ -0,0 +1,309 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// PatchTypesViaJSON fuzzes two objects of the kind selected by typeToTest, an
+// original and a modified one. It creates a two-way strategic merge patch and
+// a JSON merge patch from the original to the modified object, applies each
+// to the original, and checks that the result equals the modified object.
+// Missing patchStrategy and patchMergeKey tags show up here.
+func PatchTypesViaJSON(data []byte, typeToTest int) error {
+	return defaultHarness().PatchTypesViaJSON(data, typeToTest)
+}
+
+// PatchTypesViaJSON is like the package level PatchTypesViaJSON, for the
+// kinds of the scheme of h.
+func (h *Harness) PatchTypesViaJSON(data []byte, typeToTest int) error {
+	kinds := h.roundTrippableKinds()
+	if len(kinds) == 0 {
+		return fmt.Errorf("no round trippable kinds are registered in the scheme")
+	}
+	return h.patchOfExternalType(data, selectKind(kinds, typeToTest))
+}
+
+func (h *Harness) patchOfExternalType(data []byte, externalGVK schema.GroupVersionKind) error {
+	ff := h.newConsumer(data)
+	objects := make([]runtime.Object, 2)
+	var genErr error
+	for i := range objects {
+		object, err := h.scheme.New(externalGVK)
+		if err != nil {
+			panic(fmt.Sprintf("Couldn't make a %v? %v", externalGVK, err))
+		}
+		if objects[i], err = generateObject(ff, object); err != nil && genErr == nil {
+			genErr = err
+		}
+	}
+	h.stats.recordGeneration(externalGVK, genErr)
+	return h.stats.recordResult(externalGVK, h.checkPatches(externalGVK, objects[0], objects[1]))
+}
+
+// checkPatches checks that patching original with the patches computed from
+// original to modified gives modified. What patches can't describe is
+// dropped from both first, see patchable.
+func (h *Harness) checkPatches(gvk schema.GroupVersionKind, original, modified runtime.Object) error {
+	original, modified = original.DeepCopyObject(), modified.DeepCopyObject()
+	patchable(reflect.ValueOf(original))
+	patchable(reflect.ValueOf(modified))
+
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return nil
+	}
+	// compare against modified as it comes back from JSON, since that is
+	// all a patch can describe
+	expected := reflect.New(reflect.TypeOf(modified).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(modifiedJSON, expected); err != nil {
+		return nil
+	}
+
+	dataStruct := reflect.New(reflect.TypeOf(original).Elem()).Interface()
+	patch, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, dataStruct)
+	if err != nil {
+		return patchCreationError(gvk, string(types.StrategicMergePatchType), StageStrategicMergePatch, original, err)
+	}
+	patched, err := strategicpatch.StrategicMergePatch(originalJSON, patch, dataStruct)
+	if err := h.checkPatched(gvk, string(types.StrategicMergePatchType), StageStrategicMergePatch, original, expected, patch, patched, err); err != nil {
+		return err
+	}
+
+	patch, err = jsonpatch.CreateMergePatch(originalJSON, modifiedJSON)
+	if err != nil {
+		return patchCreationError(gvk, string(types.MergePatchType), StageJSONMergePatch, original, err)
+	}
+	patched, err = jsonpatch.MergePatch(originalJSON, patch)
+	return h.checkPatched(gvk, string(types.MergePatchType), StageJSONMergePatch, original, expected, patch, patched, err)
+}
+
+// patchCreationError reports that no patch from original to the modified
+// object could be created, usually because of wrong patchStrategy or
+// patchMergeKey tags.
+func patchCreationError(gvk schema.GroupVersionKind, patchType string, stage Stage, original runtime.Object, err error) error {
+	return &RoundTripError{
+		GVK:      gvk,
+		Codec:    patchType,
+		Stage:    stage,
+		Original: original,
+		Err:      fmt.Errorf("creating the patch: %w", err),
+	}
+}
+
+// checkPatched compares the result of applying patch with expected. applyErr
+// is the error returned when applying the patch.
+func (h *Harness) checkPatched(gvk schema.GroupVersionKind, patchType string, stage Stage, original, expected runtime.Object, patch, patched []byte, applyErr error) error {
+	fail := func(stage Stage) *RoundTripError {
+		return &RoundTripError{GVK: gvk, Codec: patchType, Stage: stage, Original: original, Data: patch}
+	}
+	if applyErr != nil {
+		e := fail(StagePatchApply)
+		e.Err = applyErr
+		return e
+	}
+
+	result := reflect.New(reflect.TypeOf(expected).Elem()).Interface().(runtime.Object)
+	if err := json.Unmarshal(patched, result); err != nil {
+		e := fail(StageDecode)
+		e.Err = err
+		return e
+	}
+	if !codecEquality.DeepEqual(expected, result) {
+		e := fail(stage)
+		e.Decoded = result
+		e.Fields, e.Diff = h.fieldDiffs(expected, result)
+		return e
+	}
+	return nil
+}
+
+// patchable drops what patches can't describe from v, so that failures point
+// at the patch metadata of the types:
+//   - fields holding RawExtensions or maps of lists and objects, since
+//     strategic merge patches look up the fields of their JSON in the Go type
+//     and find none,
+//   - items of merging lists whose merge key an earlier item has, and repeated
+//     items of merging lists of primitives, since patches remove them together,
+//   - null members of raw JSON, since patches delete members set to null.
+func patchable(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			patchable(v.Elem())
+		}
+	case reflect.Struct:
+		if v.Type() == rawExtensionType {
+			raw := v.Addr().Interface().(*runtime.RawExtension)
+			raw.Raw = withoutJSONNulls(raw.Raw)
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field, f := v.Type().Field(i), v.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if !patchableType(field.Type) {
+				f.Set(reflect.Zero(field.Type))
+				continue
+			}
+			if f.Kind() == reflect.Slice && strings.Contains(field.Tag.Get("patchStrategy"), "merge") {
+				dropDuplicateItems(f, field.Tag.Get("patchMergeKey"))
+			}
+			patchable(f)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			patchable(v.Index(i))
+		}
+	}
+}
+
+var rawExtensionType = reflect.TypeOf(runtime.RawExtension{})
+
+// patchableType reports whether strategic merge patches can describe the
+// fields of type t.
+func patchableType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == rawExtensionType {
+		return false
+	}
+	if t.Kind() != reflect.Map {
+		return true
+	}
+	// map values must be JSON scalars
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	switch elem.Kind() {
+	case reflect.Slice:
+		return elem.Elem().Kind() == reflect.Uint8
+	case reflect.Array, reflect.Map, reflect.Interface:
+		return false
+	case reflect.Struct:
+		return reflect.PtrTo(elem).Implements(marshalerType)
+	}
+	return true
+}
+
+// dropDuplicateItems keeps the first of the items of the merging list v that
+// have the same mergeKey, or are the same primitive if mergeKey is empty. Items
+// whose merge key is empty and omitted from their JSON are dropped, since no
+// valid object has them, but items of types without the merge key are kept for
+// the patch to reject.
+func dropDuplicateItems(v reflect.Value, mergeKey string) {
+	if v.Len() == 0 {
+		return
+	}
+	seen := make(map[interface{}]bool, v.Len())
+	items := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		key, omitted, ok := itemKey(item, mergeKey)
+		if omitted || ok && seen[key] {
+			continue
+		}
+		if ok {
+			seen[key] = true
+		}
+		items = reflect.Append(items, item)
+	}
+	v.Set(items)
+}
+
+// itemKey returns the value of the field of item whose JSON name is mergeKey,
+// or item itself if mergeKey is empty. omitted reports whether the field is
+// left out of the JSON of item.
+func itemKey(item reflect.Value, mergeKey string) (key interface{}, omitted, ok bool) {
+	for item.Kind() == reflect.Ptr {
+		if item.IsNil() {
+			return nil, false, false
+		}
+		item = item.Elem()
+	}
+	if mergeKey == "" {
+		return item.Interface(), false, item.Type().Comparable() && item.Kind() != reflect.Struct
+	}
+	if item.Kind() != reflect.Struct {
+		return nil, false, false
+	}
+	for i := 0; i < item.NumField(); i++ {
+		field := item.Type().Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] != mergeKey || !field.Type.Comparable() {
+			continue
+		}
+		omitted = item.Field(i).IsZero() && sets.NewString(tag[1:]...).Has("omitempty")
+		return item.Field(i).Interface(), omitted, true
+	}
+	return nil, false, false
+}
+
+// withoutJSONNulls returns raw without the members of its objects that are
+// null, or raw itself if it has none.
+func withoutJSONNulls(raw []byte) []byte {
+	var value interface{}
+	if json.Unmarshal(raw, &value) != nil || !dropJSONNulls(value) {
+		return raw
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return raw
+	}
+	return data
+}
+
+// dropJSONNulls removes the null members of the objects in value and reports
+// whether there were any.
+func dropJSONNulls(value interface{}) bool {
+	dropped := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, member := range value {
+			if member == nil {
+				delete(value, k)
+				dropped = true
+			} else if dropJSONNulls(member) {
+				dropped = true
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if dropJSONNulls(item) {
+				dropped = true
+			}
+		}
+	}
+	return dropped
+}
@@ -18,25 +18,35 @@ package roundtrip
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	gfh "github.com/AdaLogics/go-fuzz-headers"
 	"github.com/google/go-cmp/cmp"
-	"github.com/davecgh/go-spew/spew"
-	"github.com/golang/protobuf/proto"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
-	"k8s.io/apimachinery/pkg/runtime/serializer/json"
-	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
 	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"reflect"
-	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var (
+	// protobufPrefix is the magic number written by protobuf.NewSerializer.
+	protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+	// codecEquality compares objects decoded by codecs. It is
+	// apiequality.Semantic, except that the raw JSON of RawExtensions and
+	// FieldsV1 is compared as JSON values, since the pretty JSON encoder
+	// indents it and the YAML serializer sorts its keys.
+	codecEquality = newCodecEquality()
+
 	globalNonRoundTrippableTypes = sets.NewString(
 		"ExportOptions",
 		"GetOptions",
@@ -52,29 +62,28 @@ var (
 	)
 )
 
+// ExternalTypesViaJSON fuzzes an object of the kind selected by typeToTest
+// and round trips it through every media type supported by a CodecFactory for
+// Scheme, plus the ones added with AddSerializers. Kinds are selected from a
+// sorted list, so an input always tests the same kind of a given scheme. It
+// returns a *RoundTripError if the object does not survive a round trip; any
+// other error means the input could not be used.
 func ExternalTypesViaJSON(data []byte, typeToTest int) error {
-	codecFactory := serializer.NewCodecFactory(Scheme)
-	fuzzCodecFactory = codecFactory
+	return defaultHarness().ExternalTypesViaJSON(data, typeToTest)
+}
 
-	kinds := Scheme.AllKnownTypes()
-	i := 0
-	for gvk := range kinds {
-		if gvk.Version == runtime.APIVersionInternal || globalNonRoundTrippableTypes.Has(gvk.Kind) {
-			return fmt.Errorf("Invalid type")
-		}
-		if i == typeToTest%len(kinds) {
-			err := roundTripOfExternalType(data, gvk)
-			if err != nil {
-				return err
-			}
-		}
-		i++
+// ExternalTypesViaJSON is like the package level ExternalTypesViaJSON, for
+// the kinds of the scheme of h.
+func (h *Harness) ExternalTypesViaJSON(data []byte, typeToTest int) error {
+	kinds := h.roundTrippableKinds()
+	if len(kinds) == 0 {
+		return fmt.Errorf("no round trippable kinds are registered in the scheme")
 	}
-	return nil
+	return h.roundTripOfExternalType(data, selectKind(kinds, typeToTest), h.mediaTypes())
 }
 
-func roundTripOfExternalType(data []byte, externalGVK schema.GroupVersionKind) error {
-	object, err := Scheme.New(externalGVK)
+func (h *Harness) roundTripOfExternalType(data []byte, externalGVK schema.GroupVersionKind, serializers []runtime.SerializerInfo) error {
+	object, err := h.scheme.New(externalGVK)
 	if err != nil {
 		panic(fmt.Sprintf("Couldn't make a %v? %v", externalGVK, err))
 	}
@@ -84,28 +93,104 @@ func roundTripOfExternalType(data []byte, externalGVK schema.GroupVersionKind) e
 		panic(fmt.Sprintf("%q is not a TypeMeta and cannot be tested - add it to nonRoundTrippableInternalTypes: %v", externalGVK, err))
 	}
 
-	object, err = fuzzInternalObject(data, object)
-	if err != nil {
-		return err
-	}
+	object, err = h.fuzzInternalObject(data, object)
+	h.stats.recordGeneration(externalGVK, err)
 
 	typeAcc.SetKind(externalGVK.Kind)
 	typeAcc.SetAPIVersion(externalGVK.GroupVersion().String())
 
-	roundTrip(json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false), object)
+	return h.stats.recordResult(externalGVK, h.roundTripObject(externalGVK, object, serializers))
+}
 
-	// TODO remove this hack after we're past the intermediate steps
-	roundTrip(protobuf.NewSerializer(Scheme, Scheme), object)
-	return nil
+// roundTripObject round trips object through every serializer that supports
+// it and compares the results of the serializers with each other.
+func (h *Harness) roundTripObject(externalGVK schema.GroupVersionKind, object runtime.Object, serializers []runtime.SerializerInfo) error {
+	validate, hasValidation := h.validations[externalGVK]
+	var validationErrs field.ErrorList
+	if hasValidation {
+		var err error
+		validationErrs, err = runValidation(externalGVK, validationCodecName, validate, object)
+		if err != nil {
+			return err
+		}
+	}
+
+	var reference *runtime.SerializerInfo
+	for i := range serializers {
+		info := serializers[i]
+		if !supportsObject(info, object) {
+			continue
+		}
+
+		if err := checkManagedFields(externalGVK, info.MediaType, info.Serializer, object); err != nil {
+			return err
+		}
+		if err := h.roundTrip(externalGVK, info.MediaType, info.Serializer, object); err != nil {
+			return err
+		}
+
+		// a round trip must not turn a valid object into an invalid one, or
+		// the other way around
+		if hasValidation {
+			if err := checkValidation(externalGVK, info.MediaType, info.Serializer, validate, object, validationErrs); err != nil {
+				return err
+			}
+		}
+
+		// kubectl and most tooling write indented JSON
+		if info.PrettySerializer != nil {
+			if err := h.roundTrip(externalGVK, prettyCodecName(info.MediaType), info.PrettySerializer, object); err != nil {
+				return err
+			}
+			if err := h.prettyParity(externalGVK, info.MediaType, info.Serializer, info.PrettySerializer, object); err != nil {
+				return err
+			}
+		}
+
+		// the lenient decoders silently accept duplicate and unknown fields,
+		// so make sure the encoder doesn't produce any.
+		if info.StrictSerializer != nil && info.StrictSerializer != info.Serializer {
+			if err := strictRoundTrip(externalGVK, info.MediaType, info.Serializer, info.StrictSerializer, object); err != nil {
+				return err
+			}
+		}
+
+		// a field that survives one wire format but not another is only
+		// caught by comparing them
+		if reference == nil {
+			reference = &serializers[i]
+			continue
+		}
+		if err := h.crossCodecEquivalence(externalGVK, reference.MediaType, reference.Serializer, info.MediaType, info.Serializer, object); err != nil {
+			return err
+		}
+	}
+
+	// dynamic clients see objects through the unstructured converter
+	return h.unstructuredRoundTrip(externalGVK, object)
 }
 
-func fuzzInternalObject(data []byte, object runtime.Object) (runtime.Object, error) {
+func (h *Harness) fuzzInternalObject(data []byte, object runtime.Object) (runtime.Object, error) {
+	return generateObject(h.newConsumer(data), object)
+}
+
+// newConsumer returns a consumer of data that knows the custom fuzzer funcs
+// of h.
+func (h *Harness) newConsumer(data []byte) *gfh.ConsumeFuzzer {
 	ff := gfh.NewConsumer(data)
-	for i := range customFuncs {
-		//fmt.Println("Adding ", customFuncs[i])
-		ff.AddFuncs(customFuncs[i])
-	}
-	ff.GenerateWithCustom(object)
+	ff.AddFuncs(h.funcs.Funcs())
+	return ff
+}
+
+// generateObject fills object from ff and clears its TypeMeta. Several
+// objects can be generated from the same consumer. The object can be used even
+// if an error is returned: the error only says why generation stopped early,
+// usually because ff ran out of data, and the rest of the object was left
+// empty.
+func generateObject(ff *gfh.ConsumeFuzzer, object runtime.Object) (runtime.Object, error) {
+	genErr := generateValue(ff, reflect.ValueOf(object).Elem(), 0)
+	sanitize(reflect.ValueOf(object))
+	fuzzManagedFields(ff, object)
 
 	j, err := apimeta.TypeAccessor(object)
 	if err != nil {
@@ -114,89 +199,121 @@ func fuzzInternalObject(data []byte, object runtime.Object) (runtime.Object, err
 	j.SetKind("")
 	j.SetAPIVersion("")
 
-	return object, nil
+	return object, genErr
 }
 
-func roundTrip(codec runtime.Codec, object runtime.Object) {
-	printer := spew.ConfigState{DisableMethods: true}
+// roundTrip encodes object with codec, decodes it again and checks that
+// nothing was lost on the way. Encode errors are not reported since the
+// fuzzer is free to produce objects that cannot be serialized.
+func (h *Harness) roundTrip(gvk schema.GroupVersionKind, codecName string, codec runtime.Codec, object runtime.Object) (err error) {
+	encodeIgnored := false
+	defer func() {
+		h.stats.recordCodec(gvk, codecName, encodeIgnored, err)
+	}()
+
 	original := object
+	fail := func(stage Stage) *RoundTripError {
+		return &RoundTripError{GVK: gvk, Codec: codecName, Stage: stage, Original: original}
+	}
 
 	// deep copy the original object
 	object = object.DeepCopyObject()
-	name := reflect.TypeOf(object).Elem().Name()
 	if !apiequality.Semantic.DeepEqual(original, object) {
-		fmt.Printf("%v: DeepCopy altered the object, diff: %v\n", name, diff.ObjectReflectDiff(original, object))
-		fmt.Printf("%s\n", spew.Sdump(original))
-		fmt.Printf("%s\n", spew.Sdump(object))
-		panic("not equal")
+		e := fail(StageDeepCopy)
+		e.Decoded = object
+		e.Diff = diff.ObjectReflectDiff(original, object)
+		return e
 	}
 
 	// encode (serialize) the deep copy using the provided codec
 	data, err := runtime.Encode(codec, object)
 	if err != nil {
-		return
+		encodeIgnored = true
+		return nil
 	}
 
 	// ensure that the deep copy is equal to the original; neither the deep
 	// copy or conversion should alter the object
-	// TODO eliminate this global
 	if !apiequality.Semantic.DeepEqual(original, object) {
-		panic(fmt.Sprintf("%v: encode altered the object, diff: %v\n", name, diff.ObjectReflectDiff(original, object)))
-		return
+		e := fail(StageEncodeAltered)
+		e.Decoded = object
+		e.Data = data
+		e.Diff = diff.ObjectReflectDiff(original, object)
+		return e
 	}
 
 	// encode (serialize) a second time to verify that it was not varying
 	secondData, err := runtime.Encode(codec, object)
 	if err != nil {
 		if runtime.IsNotRegisteredError(err) {
-			return
-		} else {
-			panic(fmt.Sprintf("%v: %v (%s)", name, err, printer.Sprintf("%#v", object)))
+			return nil
 		}
+		e := fail(StageEncode)
+		e.Data = data
+		e.Err = err
+		return e
 	}
 
 	// serialization to the wire must be stable to ensure that we don't write twice to the DB
 	// when the object hasn't changed.
 	if !bytes.Equal(data, secondData) {
-		panic(fmt.Sprintf("%v: serialization is not stable: %s", name, printer.Sprintf("%#v", object)))
+		e := fail(StageUnstableEncoding)
+		e.Data = data
+		e.Diff = cmp.Diff(encodedString(data), encodedString(secondData))
+		return e
 	}
 
 	// decode (deserialize) the encoded data back into an object
 	obj2, err := runtime.Decode(codec, data)
 	if err != nil {
-		panic(fmt.Sprintf("%v: %v\nCodec: %#v\nData: %s\nSource: %#v\n", name, err, codec, dataAsString(data), printer.Sprintf("%#v", object)))
+		e := fail(StageDecode)
+		e.Data = data
+		e.Err = err
+		return e
 	}
 
 	// ensure that the object produced from decoding the encoded data is equal
 	// to the original object
-	if !apiequality.Semantic.DeepEqual(original, obj2) {
-		panic(fmt.Sprintf("%v: diff: %v\nCodec: %#v\nSource:\n\n%#v\n\nEncoded:\n\n%s\n\nFinal:\n\n%#v\n", name, cmp.Diff(original, obj2, CmpOpts...), codec, printer.Sprintf("%#v", original), dataAsString(data), printer.Sprintf("%#v", obj2)))
+	if !codecEquality.DeepEqual(original, obj2) {
+		e := fail(StageSemanticDiff)
+		e.Decoded = obj2
+		e.Data = data
+		e.Diff = cmp.Diff(original, obj2, h.cmpOpts...)
+		return e
 	}
 
 	// decode the encoded data into a new object (instead of letting the codec
 	// create a new object)
 	obj3 := reflect.New(reflect.TypeOf(object).Elem()).Interface().(runtime.Object)
 	if err := runtime.DecodeInto(codec, data, obj3); err != nil {
-		panic(fmt.Sprintf("%v: %v", name, err))
+		e := fail(StageDecodeInto)
+		e.Data = data
+		e.Err = err
+		return e
 	}
 
 	// special case for kinds which are internal and external at the same time (many in meta.k8s.io are). For those
 	// runtime.DecodeInto above will return the external variant and set the APIVersion and kind, while the input
 	// object might be internal. Hence, we clear those values for obj3 for that case to correctly compare.
-	intAndExt, err := internalAndExternalKind(object)
+	intAndExt, err := h.internalAndExternalKind(object)
 	if err != nil {
-		panic(fmt.Sprintf("%v: %v", name, err))
+		e := fail(StageTypeMeta)
+		e.Err = err
+		return e
 	}
 	if intAndExt {
 		typeAcc, err := apimeta.TypeAccessor(object)
 		if err != nil {
-			panic(fmt.Sprintf("%v: error accessing TypeMeta: %v\n", name, err))
-
+			e := fail(StageTypeMeta)
+			e.Err = fmt.Errorf("error accessing TypeMeta: %w", err)
+			return e
 		}
 		if len(typeAcc.GetAPIVersion()) == 0 {
 			typeAcc, err := apimeta.TypeAccessor(obj3)
 			if err != nil {
-				panic(fmt.Sprintf("%v: error accessing TypeMeta: %v", name, err))
+				e := fail(StageTypeMeta)
+				e.Err = fmt.Errorf("error accessing TypeMeta: %w", err)
+				return e
 			}
 			typeAcc.SetAPIVersion("")
 			typeAcc.SetKind("")
@@ -205,24 +322,225 @@ func roundTrip(codec runtime.Codec, object runtime.Object) {
 
 	// ensure that the new runtime object is equal to the original after being
 	// decoded into
-	//fmt.Println("Here")
-	if !apiequality.Semantic.DeepEqual(object, obj3) {
-		panic(fmt.Sprintf("%v: diff: %v\nCodec: %#v", name, diff.ObjectReflectDiff(object, obj3), codec))
+	if !codecEquality.DeepEqual(object, obj3) {
+		e := fail(StageDecodeIntoDiff)
+		e.Decoded = obj3
+		e.Data = data
+		e.Diff = diff.ObjectReflectDiff(object, obj3)
+		return e
 	}
 
-	// do structure-preserving fuzzing of the deep-copied object. If it shares anything with the original,
-	// the deep-copy was actually only a shallow copy. Then original and obj3 will be different after fuzzing.
+	// change every value of the deep-copied object in place. If it shares anything with the original,
+	// the deep-copy was actually only a shallow copy. Then original and obj3 will be different afterwards.
 	// NOTE: we use the encoding+decoding here as an alternative, guaranteed deep-copy to compare against.
+	changeValues(reflect.ValueOf(object), 0)
+	if !codecEquality.DeepEqual(original, obj3) {
+		e := fail(StageCopyAliasing)
+		e.Decoded = obj3
+		e.Data = data
+		e.Diff = diff.ObjectReflectDiff(original, obj3)
+		return e
+	}
+	return nil
+}
+
+// changeValues changes every scalar reachable from v in place, keeping the
+// structure of v: the same pointers, slices and maps, with the same lengths
+// and keys. Every value ends up different from what it was.
+func changeValues(v reflect.Value, depth int) {
+	if depth > maxGenerateDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			changeValues(v.Elem(), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			changeValues(v.Field(i), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			changeValues(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values aren't addressable, so they are changed on a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			changeValues(value, depth+1)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+	if !v.CanSet() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(v.String() + "x")
+	case reflect.Bool:
+		v.SetBool(!v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(v.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(v.Uint() + 1)
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == 0 {
+			v.SetFloat(1)
+		} else {
+			v.SetFloat(-f)
+		}
+	}
+}
+
+func newCodecEquality() conversion.Equalities {
+	e := apiequality.Semantic.Copy()
+	err := e.AddFuncs(
+		func(a, b runtime.RawExtension) bool {
+			return equalJSON(a.Raw, b.Raw) && e.DeepEqual(a.Object, b.Object)
+		},
+		func(a, b metav1.FieldsV1) bool {
+			return equalJSON(a.Raw, b.Raw)
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// equalJSON reports whether a and b are the same bytes or the same JSON value.
+func equalJSON(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var valueA, valueB interface{}
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
+
+// prettyParity checks that the compact and the pretty encodings of object
+// decode to the same object.
+func (h *Harness) prettyParity(gvk schema.GroupVersionKind, mediaType string, compact, pretty runtime.Codec, object runtime.Object) error {
+	compactData, err := runtime.Encode(compact, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+	prettyData, err := runtime.Encode(pretty, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+
+	fail := func(stage Stage, data []byte) *RoundTripError {
+		return &RoundTripError{GVK: gvk, Codec: prettyCodecName(mediaType), Stage: stage, Original: object, Data: data}
+	}
+	fromCompact, err := runtime.Decode(compact, compactData)
+	if err != nil {
+		e := fail(StageDecode, compactData)
+		e.Codec = mediaType
+		e.Err = err
+		return e
+	}
+	fromPretty, err := runtime.Decode(pretty, prettyData)
+	if err != nil {
+		e := fail(StageDecode, prettyData)
+		e.Err = err
+		return e
+	}
+	if !codecEquality.DeepEqual(fromCompact, fromPretty) {
+		e := fail(StagePrettyParity, prettyData)
+		e.Decoded = fromPretty
+		e.Diff = cmp.Diff(fromCompact, fromPretty, h.cmpOpts...)
+		return e
+	}
+	return nil
+}
+
+// crossCodecEquivalence checks that object decodes to the same object when it
+// is encoded with codec a and with codec b. Objects that one of the codecs
+// can't encode are not compared.
+func (h *Harness) crossCodecEquivalence(gvk schema.GroupVersionKind, aName string, a runtime.Codec, bName string, b runtime.Codec, object runtime.Object) error {
+	aData, err := runtime.Encode(a, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+	bData, err := runtime.Encode(b, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+
+	fail := func(stage Stage, codecName string, data []byte) *RoundTripError {
+		return &RoundTripError{GVK: gvk, Codec: codecName, Stage: stage, Original: object, Data: data}
+	}
+	fromA, err := runtime.Decode(a, aData)
+	if err != nil {
+		e := fail(StageDecode, aName, aData)
+		e.Err = err
+		return e
+	}
+	fromB, err := runtime.Decode(b, bData)
+	if err != nil {
+		e := fail(StageDecode, bName, bData)
+		e.Err = err
+		return e
+	}
+	if !codecEquality.DeepEqual(fromA, fromB) {
+		e := fail(StageCrossCodec, aName+" vs "+bName, bData)
+		e.Decoded = fromB
+		e.Fields, e.Diff = h.fieldDiffs(fromA, fromB)
+		return e
+	}
+	return nil
+}
+
+// strictRoundTrip encodes object with encoder and decodes the result with the
+// strict decoder, failing if the encoder's own output is rejected.
+func strictRoundTrip(gvk schema.GroupVersionKind, mediaType string, encoder runtime.Encoder, strict runtime.Decoder, object runtime.Object) error {
+	data, err := runtime.Encode(encoder, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
 
-	//TODO: Use gfh here
-	//fuzzer.ValueFuzz(object)
-	if !apiequality.Semantic.DeepEqual(original, obj3) {
-		panic(fmt.Sprintf("%v: fuzzing a copy altered the original, diff: %v", name, diff.ObjectReflectDiff(original, obj3)))
+	decoded, err := runtime.Decode(strict, data)
+	if err == nil {
+		return nil
 	}
+	e := &RoundTripError{
+		GVK:      gvk,
+		Codec:    strictCodecName(mediaType),
+		Stage:    StageDecode,
+		Original: object,
+		Decoded:  decoded,
+		Data:     data,
+		Err:      err,
+	}
+	if strictErr, ok := runtime.AsStrictDecodingError(err); ok {
+		e.Stage = StageStrictDecode
+		e.Fields = strictFieldPaths(strictErr.Errors())
+	}
+	return e
 }
 
-func internalAndExternalKind(object runtime.Object) (bool, error) {
-	kinds, _, err := Scheme.ObjectKinds(object)
+// strictFieldPaths returns the paths of the fields that strict decoding
+// complained about.
+func strictFieldPaths(errs []error) []string {
+	paths := make([]string, 0, len(errs))
+	for _, err := range errs {
+		if fieldErr, ok := err.(interface{ FieldPath() string }); ok {
+			paths = append(paths, fieldErr.FieldPath())
+		} else {
+			paths = append(paths, err.Error())
+		}
+	}
+	return paths
+}
+
+func (h *Harness) internalAndExternalKind(object runtime.Object) (bool, error) {
+	kinds, _, err := h.scheme.ObjectKinds(object)
 	if err != nil {
 		return false, err
 	}
@@ -237,13 +555,27 @@ func internalAndExternalKind(object runtime.Object) (bool, error) {
 	return internal && external, nil
 }
 
-// dataAsString returns the given byte array as a string; handles detecting
-// protocol buffers.
-func dataAsString(data []byte) string {
-	dataString := string(data)
-	if !strings.HasPrefix(dataString, "{") {
-		dataString = "\n" + hex.Dump(data)
-		proto.NewBuffer(make([]byte, 0, 1024)).DebugPrint("decoded object", data)
+// protoDebugString prints the fields of protobuf encoded data by number, like
+// proto.Buffer.DebugPrint does, but returns the result instead of writing it
+// to stdout.
+func protoDebugString(data []byte) string {
+	m := new(emptypb.Empty)
+	m.ProtoReflect().SetUnknown(bytes.TrimPrefix(data, protobufPrefix))
+	text, _ := prototext.MarshalOptions{AllowPartial: true, EmitUnknown: true, Indent: "\t"}.Marshal(m)
+	return fmt.Sprintf("==== decoded object ====\n%s==== decoded object ====\n", text)
+}
+
+// encodedString returns data as text, or as a hex dump if it is protobuf. It
+// has no side effects, so it is safe to use from Error methods.
+func encodedString(data []byte) string {
+	if isProtobuf(data) {
+		return "\n" + hex.Dump(data)
 	}
-	return dataString
+	return string(data)
+}
+
+// isProtobuf reports whether data starts with the magic number of the
+// Kubernetes protobuf serializer.
+func isProtobuf(data []byte) bool {
+	return bytes.HasPrefix(data, protobufPrefix)
 }
@@ -0,0 +1,387 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+func init() {
+	if err := corev1.AddToScheme(Scheme); err != nil {
+		panic(err)
+	}
+}
+
+var configMapGVK = corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+func testConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+}
+
+// testList returns a List whose item is raw JSON with unsorted keys.
+func testList() *corev1.List {
+	return &corev1.List{
+		TypeMeta: metav1.TypeMeta{Kind: "List", APIVersion: "v1"},
+		Items:    []runtime.RawExtension{{Raw: []byte(`{"kind":"Status","apiVersion":"v1","metadata":{}}`)}},
+	}
+}
+
+// unstableCodec appends a growing amount of whitespace to every encode.
+type unstableCodec struct {
+	runtime.Codec
+	calls int
+}
+
+func (c *unstableCodec) Encode(obj runtime.Object, w io.Writer) error {
+	c.calls++
+	if err := c.Codec.Encode(obj, w); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(strings.Repeat(" ", c.calls)))
+	return err
+}
+
+// lossyCodec drops the data of every ConfigMap it decodes.
+type lossyCodec struct {
+	runtime.Codec
+}
+
+func (c lossyCodec) Decode(data []byte, defaults *schema.GroupVersionKind, into runtime.Object) (runtime.Object, *schema.GroupVersionKind, error) {
+	obj, gvk, err := c.Codec.Decode(data, defaults, into)
+	if cm, ok := obj.(*corev1.ConfigMap); ok {
+		cm.Data = nil
+	}
+	return obj, gvk, err
+}
+
+// duplicatingCodec repeats the first field of every encoded object.
+type duplicatingCodec struct {
+	runtime.Codec
+}
+
+func (c duplicatingCodec) Encode(obj runtime.Object, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := c.Codec.Encode(obj, &buf); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	first := data[1 : bytes.IndexByte(data, ',')+1]
+	_, err := w.Write(append([]byte{'{'}, append(first, data[1:]...)...))
+	return err
+}
+
+func TestRoundTrip(t *testing.T) {
+	codecs := map[string]runtime.Codec{
+		runtime.ContentTypeJSON: json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false),
+		runtime.ContentTypeYAML: json.NewYAMLSerializer(json.DefaultMetaFactory, Scheme, Scheme),
+	}
+	for name, codec := range codecs {
+		cm := testConfigMap()
+		cm.Data["multi-line"] = "first\nsecond\n"
+		cm.Data["bool"] = "true"
+		cm.Data["number"] = "012"
+		if err := defaultHarness().roundTrip(configMapGVK, name, codec, cm); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestRoundTripOfRawExtensions(t *testing.T) {
+	codecs := map[string]runtime.Codec{
+		prettyCodecName(runtime.ContentTypeJSON): json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, true),
+		runtime.ContentTypeYAML:                  json.NewYAMLSerializer(json.DefaultMetaFactory, Scheme, Scheme),
+	}
+	gvk := corev1.SchemeGroupVersion.WithKind("List")
+	for name, codec := range codecs {
+		if err := defaultHarness().roundTrip(gvk, name, codec, testList()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestRoundTripErrorStages(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	testCases := []struct {
+		name  string
+		codec runtime.Codec
+		stage Stage
+	}{
+		{name: "unstable", codec: &unstableCodec{Codec: jsonCodec}, stage: StageUnstableEncoding},
+		{name: "lossy", codec: lossyCodec{Codec: jsonCodec}, stage: StageSemanticDiff},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := defaultHarness().roundTrip(configMapGVK, tc.name, tc.codec, testConfigMap())
+			var rtErr *RoundTripError
+			if !errors.As(err, &rtErr) {
+				t.Fatalf("expected a *RoundTripError, got %v", err)
+			}
+			if rtErr.Stage != tc.stage {
+				t.Errorf("expected stage %s, got %s", tc.stage, rtErr.Stage)
+			}
+			if rtErr.GVK != configMapGVK || rtErr.Codec != tc.name {
+				t.Errorf("unexpected GVK or codec: %v %s", rtErr.GVK, rtErr.Codec)
+			}
+			if len(rtErr.Data) == 0 || len(rtErr.Diff) == 0 {
+				t.Errorf("expected encoded data and a diff, got %q and %q", rtErr.Data, rtErr.Diff)
+			}
+		})
+	}
+}
+
+func TestRoundTripCopyAliasing(t *testing.T) {
+	gvk := widgetGroupVersion.WithKind("SharedWidget")
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(gvk, &sharedWidget{})
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, scheme, scheme, false)
+
+	widget := &sharedWidget{
+		TypeMeta: metav1.TypeMeta{Kind: gvk.Kind, APIVersion: gvk.GroupVersion().String()},
+		Sizes:    []int64{1, 2},
+	}
+	err := newHarness(t, WithScheme(scheme)).roundTrip(gvk, runtime.ContentTypeJSON, jsonCodec, widget)
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) || rtErr.Stage != StageCopyAliasing {
+		t.Fatalf("expected a failure at stage %s, got %v", StageCopyAliasing, err)
+	}
+}
+
+// sharedWidget has a DeepCopyObject that shares Sizes with the copy.
+type sharedWidget struct {
+	metav1.TypeMeta `json:",inline"`
+	Sizes           []int64 `json:"sizes"`
+}
+
+func (w *sharedWidget) DeepCopyObject() runtime.Object {
+	out := *w
+	return &out
+}
+
+func TestStrictRoundTrip(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	strict := json.NewSerializerWithOptions(json.DefaultMetaFactory, Scheme, Scheme, json.SerializerOptions{Strict: true})
+	if err := strictRoundTrip(configMapGVK, runtime.ContentTypeJSON, jsonCodec, strict, testConfigMap()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := strictRoundTrip(configMapGVK, runtime.ContentTypeJSON, duplicatingCodec{Codec: jsonCodec}, strict, testConfigMap())
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageStrictDecode {
+		t.Errorf("expected stage %s, got %s", StageStrictDecode, rtErr.Stage)
+	}
+	if len(rtErr.Fields) != 1 || rtErr.Fields[0] != "kind" {
+		t.Errorf("expected the duplicated kind field to be reported, got %v", rtErr.Fields)
+	}
+}
+
+func TestPrettyParity(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	prettyCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, true)
+	if err := defaultHarness().prettyParity(configMapGVK, runtime.ContentTypeJSON, jsonCodec, prettyCodec, testConfigMap()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := defaultHarness().prettyParity(configMapGVK, runtime.ContentTypeJSON, jsonCodec, lossyCodec{Codec: prettyCodec}, testConfigMap())
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StagePrettyParity {
+		t.Errorf("expected stage %s, got %s", StagePrettyParity, rtErr.Stage)
+	}
+	if rtErr.Codec != prettyCodecName(runtime.ContentTypeJSON) || len(rtErr.Diff) == 0 {
+		t.Errorf("expected a diff for the pretty codec, got %s and %q", rtErr.Codec, rtErr.Diff)
+	}
+}
+
+func TestCrossCodecEquivalence(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	protoCodec := protobuf.NewSerializer(Scheme, Scheme)
+	if err := defaultHarness().crossCodecEquivalence(configMapGVK, runtime.ContentTypeJSON, jsonCodec, runtime.ContentTypeProtobuf, protoCodec, testConfigMap()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the YAML serializer sorts the keys of raw extensions
+	yamlCodec := json.NewYAMLSerializer(json.DefaultMetaFactory, Scheme, Scheme)
+	if err := defaultHarness().crossCodecEquivalence(corev1.SchemeGroupVersion.WithKind("List"), runtime.ContentTypeJSON, jsonCodec, runtime.ContentTypeYAML, yamlCodec, testList()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := defaultHarness().crossCodecEquivalence(configMapGVK, runtime.ContentTypeJSON, jsonCodec, "lossy", lossyCodec{Codec: jsonCodec}, testConfigMap())
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageCrossCodec {
+		t.Errorf("expected stage %s, got %s", StageCrossCodec, rtErr.Stage)
+	}
+	if len(rtErr.Fields) != 1 || rtErr.Fields[0] != "Data" {
+		t.Errorf("expected Data to differ, got %v", rtErr.Fields)
+	}
+}
+
+func TestUnstructuredRoundTrip(t *testing.T) {
+	// above 2^53, so a float64 can't hold it
+	deadline := int64(1<<60 + 1)
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Namespace: "default"},
+		Spec:       corev1.PodSpec{ActiveDeadlineSeconds: &deadline},
+	}
+	if err := defaultHarness().unstructuredRoundTrip(corev1.SchemeGroupVersion.WithKind("Pod"), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the keys of raw extensions come back sorted
+	if err := defaultHarness().unstructuredRoundTrip(corev1.SchemeGroupVersion.WithKind("List"), testList()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the unstructured converter skips fields that JSON skips
+	err := defaultHarness().unstructuredRoundTrip(widgetGroupVersion.WithKind("Widget"), &hiddenWidget{
+		TypeMeta: metav1.TypeMeta{Kind: "Widget", APIVersion: widgetGroupVersion.String()},
+		Hidden:   "lost",
+	})
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageUnstructured {
+		t.Errorf("expected stage %s, got %s", StageUnstructured, rtErr.Stage)
+	}
+	if len(rtErr.Fields) != 1 || rtErr.Fields[0] != "Hidden" {
+		t.Errorf("expected Hidden to be lost, got %v", rtErr.Fields)
+	}
+}
+
+// hiddenWidget has a field that is never serialized.
+type hiddenWidget struct {
+	metav1.TypeMeta `json:",inline"`
+	Hidden          string `json:"-"`
+}
+
+func (w *hiddenWidget) DeepCopyObject() runtime.Object {
+	out := *w
+	return &out
+}
+
+func TestCheckPatches(t *testing.T) {
+	original := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Labels: map[string]string{"a": "b"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "first", Image: "busybox"},
+			{Name: "second", Image: "nginx"},
+		}},
+	}
+	modified := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "fuzz", Annotations: map[string]string{"c": "d"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "second", Image: "nginx:latest"},
+		}},
+	}
+	if err := defaultHarness().checkPatches(corev1.SchemeGroupVersion.WithKind("Pod"), original, modified); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// raw JSON with unsorted keys is patched to the same JSON value
+	if err := defaultHarness().checkPatches(corev1.SchemeGroupVersion.WithKind("List"), &corev1.List{}, testList()); err != nil {
+		t.Fatalf("unexpected error for raw extensions: %v", err)
+	}
+
+	// what patches can't describe is left out
+	for _, tc := range []struct {
+		gvk                schema.GroupVersionKind
+		original, modified runtime.Object
+	}{{
+		gvk: admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"),
+		original: &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+			Object: runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"a"}}`)},
+		}},
+		modified: &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{
+			Object: runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"b"}}`)},
+		}},
+	}, {
+		gvk: authorizationv1.SchemeGroupVersion.WithKind("LocalSubjectAccessReview"),
+		original: &authorizationv1.LocalSubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			Extra: map[string]authorizationv1.ExtraValue{"a": {"b"}},
+		}},
+		modified: &authorizationv1.LocalSubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			Extra: map[string]authorizationv1.ExtraValue{"a": {"c"}},
+		}},
+	}, {
+		gvk: corev1.SchemeGroupVersion.WithKind("Pod"),
+		original: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Finalizers:      []string{"a"},
+			OwnerReferences: []metav1.OwnerReference{{UID: "a", Name: "first"}},
+		}},
+		modified: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Finalizers:      []string{"b", "b"},
+			OwnerReferences: []metav1.OwnerReference{{UID: "b", Name: "first"}, {UID: "b", Name: "second"}},
+		}},
+	}} {
+		if err := defaultHarness().checkPatches(tc.gvk, tc.original, tc.modified); err != nil {
+			t.Errorf("unexpected error for %v: %v", tc.gvk, err)
+		}
+	}
+
+	// the items are merged by a key they don't have
+	err := defaultHarness().checkPatches(widgetGroupVersion.WithKind("Widget"),
+		&mergeWidget{Items: []mergeItem{{Value: "a"}}},
+		&mergeWidget{Items: []mergeItem{{Value: "b"}}})
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageStrategicMergePatch || rtErr.Err == nil {
+		t.Errorf("expected stage %s with an error, got %s: %v", StageStrategicMergePatch, rtErr.Stage, rtErr.Err)
+	}
+}
+
+// mergeWidget declares a patchMergeKey its items don't have.
+type mergeWidget struct {
+	metav1.TypeMeta `json:",inline"`
+	Items           []mergeItem `json:"items,omitempty" patchStrategy:"merge" patchMergeKey:"name"`
+}
+
+type mergeItem struct {
+	Value string `json:"value,omitempty"`
+}
+
+func (w *mergeWidget) DeepCopyObject() runtime.Object {
+	out := *w
+	out.Items = append([]mergeItem(nil), w.Items...)
+	return &out
+}
@@ -20,5 +20,8 @@ import (
 )
 
 var (
+	// Scheme holds the kinds the package level functions round trip. They
+	// are listed on first use, so register types with it before, or
+	// replace it.
 	Scheme = runtime.NewScheme()
 )
\ No newline at end of file
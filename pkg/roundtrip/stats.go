@@ -0,0 +1,244 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultStats holds the counters of the package level functions.
+var defaultStats = newStatsCounters()
+
+// statsCounters holds the counters of a harness. Methods on a nil
+// *statsCounters count nothing.
+type statsCounters struct {
+	lock   sync.Mutex
+	kinds  map[schema.GroupVersionKind]*Counters
+	codecs map[string]*Counters
+}
+
+func newStatsCounters() *statsCounters {
+	return &statsCounters{
+		kinds:  make(map[schema.GroupVersionKind]*Counters),
+		codecs: make(map[string]*Counters),
+	}
+}
+
+// Counters counts the round trips of a kind or through a codec.
+type Counters struct {
+	// Attempts is the number of objects round tripped.
+	Attempts int64 `json:"attempts"`
+	// GenerationFailures counts objects whose generation stopped early,
+	// usually because the input ran out. A kind where most attempts fail
+	// to generate is starved.
+	GenerationFailures int64 `json:"generationFailures"`
+	// EncodeErrorsIgnored counts objects the codec refused to encode.
+	EncodeErrorsIgnored int64 `json:"encodeErrorsIgnored"`
+	// DecodeFailures counts round trips that failed to decode.
+	DecodeFailures int64 `json:"decodeFailures"`
+	// Failures counts round trips that failed at any other stage.
+	Failures int64 `json:"failures"`
+	// Successes counts round trips that passed every check.
+	Successes int64 `json:"successes"`
+}
+
+// Stats is a snapshot of the counters of a fuzzing campaign. Kinds are keyed
+// by group/version/kind and codecs by name. Counts are per process, so with
+// "go test -fuzz" every worker has its own.
+type Stats struct {
+	Kinds  map[string]Counters `json:"kinds"`
+	Codecs map[string]Counters `json:"codecs"`
+}
+
+// CollectStats returns the counters of the package level functions collected
+// since the process started or ResetStats was last called. Every round
+// trippable kind of Scheme is included, so kinds that were never reached show
+// up with zero attempts.
+func CollectStats() Stats {
+	return defaultHarness().CollectStats()
+}
+
+// CollectStats is like the package level CollectStats, for the round trips
+// made with h. Harnesses made by NewHarness count on their own.
+func (h *Harness) CollectStats() Stats {
+	s := Stats{
+		Kinds:  make(map[string]Counters),
+		Codecs: make(map[string]Counters),
+	}
+	for _, gvk := range h.roundTrippableKinds() {
+		s.Kinds[kindKey(gvk)] = Counters{}
+	}
+	if h.stats == nil {
+		return s
+	}
+
+	h.stats.lock.Lock()
+	defer h.stats.lock.Unlock()
+	for gvk, c := range h.stats.kinds {
+		s.Kinds[kindKey(gvk)] = *c
+	}
+	for codec, c := range h.stats.codecs {
+		s.Codecs[codec] = *c
+	}
+	return s
+}
+
+// ResetStats sets the counters of the package level functions to zero.
+func ResetStats() {
+	defaultHarness().ResetStats()
+}
+
+// ResetStats sets the counters of h to zero.
+func (h *Harness) ResetStats() {
+	if h.stats == nil {
+		return
+	}
+	h.stats.lock.Lock()
+	defer h.stats.lock.Unlock()
+	h.stats.kinds = make(map[schema.GroupVersionKind]*Counters)
+	h.stats.codecs = make(map[string]*Counters)
+}
+
+// WriteJSON writes s as indented JSON.
+func (s Stats) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteTable writes s as two aligned tables, one for kinds and one for
+// codecs, sorted by name.
+func (s Stats) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, section := range []struct {
+		title    string
+		counters map[string]Counters
+	}{
+		{"KIND", s.Kinds},
+		{"CODEC", s.Codecs},
+	} {
+		fmt.Fprintf(tw, "%s\tATTEMPTS\tGENERATION FAILURES\tENCODE ERRORS IGNORED\tDECODE FAILURES\tFAILURES\tSUCCESSES\t\n", section.title)
+		names := make([]string, 0, len(section.counters))
+		for name := range section.counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := section.counters[name]
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n", name, c.Attempts, c.GenerationFailures, c.EncodeErrorsIgnored, c.DecodeFailures, c.Failures, c.Successes)
+		}
+		fmt.Fprintln(tw, "\t\t\t\t\t\t\t")
+	}
+	return tw.Flush()
+}
+
+func kindKey(gvk schema.GroupVersionKind) string {
+	return gvk.GroupVersion().String() + "/" + gvk.Kind
+}
+
+// withoutStats returns a copy of h that counts nothing.
+func (h *Harness) withoutStats() *Harness {
+	quiet := *h
+	quiet.stats = nil
+	return &quiet
+}
+
+// kindCounters returns the counters of gvk. s.lock must be held.
+func (s *statsCounters) kindCounters(gvk schema.GroupVersionKind) *Counters {
+	c, ok := s.kinds[gvk]
+	if !ok {
+		c = &Counters{}
+		s.kinds[gvk] = c
+	}
+	return c
+}
+
+// codecCounters returns the counters of codecName. s.lock must be held.
+func (s *statsCounters) codecCounters(codecName string) *Counters {
+	c, ok := s.codecs[codecName]
+	if !ok {
+		c = &Counters{}
+		s.codecs[codecName] = c
+	}
+	return c
+}
+
+// recordGeneration counts an attempt to round trip gvk, and whether
+// generating the object stopped early with genErr.
+func (s *statsCounters) recordGeneration(gvk schema.GroupVersionKind, genErr error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.kindCounters(gvk)
+	c.Attempts++
+	if genErr != nil {
+		c.GenerationFailures++
+	}
+}
+
+// recordResult counts the outcome of a round trip of gvk and returns err.
+func (s *statsCounters) recordResult(gvk schema.GroupVersionKind, err error) error {
+	if s == nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	countResult(s.kindCounters(gvk), err)
+	return err
+}
+
+// recordCodec counts a round trip of gvk through codecName.
+func (s *statsCounters) recordCodec(gvk schema.GroupVersionKind, codecName string, encodeIgnored bool, err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.codecCounters(codecName)
+	c.Attempts++
+	if encodeIgnored {
+		c.EncodeErrorsIgnored++
+		s.kindCounters(gvk).EncodeErrorsIgnored++
+		return
+	}
+	countResult(c, err)
+}
+
+func countResult(c *Counters, err error) {
+	var rtErr *RoundTripError
+	switch {
+	case err == nil:
+		c.Successes++
+	case !errors.As(err, &rtErr):
+	case rtErr.Stage == StageDecode || rtErr.Stage == StageDecodeInto || rtErr.Stage == StageStrictDecode:
+		c.DecodeFailures++
+	default:
+		c.Failures++
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	k8sjson "k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+func TestStats(t *testing.T) {
+	h := newHarness(t, WithScheme(Scheme))
+
+	jsonCodec := k8sjson.NewSerializer(k8sjson.DefaultMetaFactory, Scheme, Scheme, false)
+	h.stats.recordGeneration(configMapGVK, nil)
+	h.stats.recordResult(configMapGVK, h.roundTrip(configMapGVK, "json", jsonCodec, testConfigMap()))
+	h.stats.recordGeneration(configMapGVK, errors.New("not enough bytes left"))
+	h.stats.recordResult(configMapGVK, h.roundTrip(configMapGVK, "lossy", lossyCodec{Codec: jsonCodec}, testConfigMap()))
+
+	stats := h.CollectStats()
+	want := Counters{Attempts: 2, GenerationFailures: 1, Failures: 1, Successes: 1}
+	if got := stats.Kinds["v1/ConfigMap"]; got != want {
+		t.Errorf("expected ConfigMap counters %+v, got %+v", want, got)
+	}
+	if got := stats.Codecs["lossy"]; got.Attempts != 1 || got.Failures != 1 {
+		t.Errorf("unexpected lossy codec counters %+v", got)
+	}
+	if got, ok := stats.Kinds["v1/Pod"]; !ok || got.Attempts != 0 {
+		t.Errorf("expected Pod to be listed with no attempts, got %+v", got)
+	}
+
+	var table bytes.Buffer
+	if err := stats.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "v1/ConfigMap") {
+		t.Errorf("expected ConfigMap in the table:\n%s", table.String())
+	}
+	var out bytes.Buffer
+	if err := stats.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Stats
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded.Kinds["v1/ConfigMap"] != want {
+		t.Errorf("unexpected JSON %s: %v", out.String(), err)
+	}
+}
+
+func TestStatsArePerHarness(t *testing.T) {
+	a := newHarness(t, WithScheme(Scheme))
+	b := newHarness(t, WithScheme(Scheme))
+	if err := a.ExternalTypesViaJSON(defaultSeedInputs[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	gvk := kindKey(a.roundTrippableKinds()[0])
+	if got := a.CollectStats().Kinds[gvk].Attempts; got != 1 {
+		t.Errorf("expected one attempt, got %d", got)
+	}
+	if got := b.CollectStats().Kinds[gvk].Attempts; got != 0 {
+		t.Errorf("expected the other harness to count nothing, got %d attempts", got)
+	}
+
+	a.ResetStats()
+	if got := a.CollectStats().Kinds[gvk].Attempts; got != 0 {
+		t.Errorf("expected no attempts after a reset, got %d", got)
+	}
+}
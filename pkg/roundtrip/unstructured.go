@@ -0,0 +1,74 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// unstructuredCodecName is reported as the codec of unstructured failures.
+const unstructuredCodecName = runtime.ContentTypeJSON + " (unstructured)"
+
+// unstructuredRoundTrip converts object to unstructured, serializes it with
+// the unstructured JSON scheme, and converts the decoded result back to a
+// typed object, the way objects travel through dynamic clients. Numbers are
+// the usual suspects here: int64 values above 2^53 don't fit a float64.
+func (h *Harness) unstructuredRoundTrip(gvk schema.GroupVersionKind, object runtime.Object) error {
+	fail := func(stage Stage) *RoundTripError {
+		return &RoundTripError{GVK: gvk, Codec: unstructuredCodecName, Stage: stage, Original: object}
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object.DeepCopyObject())
+	if err != nil {
+		e := fail(StageToUnstructured)
+		e.Err = err
+		return e
+	}
+
+	data, err := runtime.Encode(unstructured.UnstructuredJSONScheme, &unstructured.Unstructured{Object: content})
+	if err != nil {
+		return nil
+	}
+
+	decoded := &unstructured.Unstructured{}
+	if _, _, err := unstructured.UnstructuredJSONScheme.Decode(data, nil, decoded); err != nil {
+		e := fail(StageDecode)
+		e.Data = data
+		e.Err = err
+		return e
+	}
+
+	typed := reflect.New(reflect.TypeOf(object).Elem()).Interface().(runtime.Object)
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(decoded.UnstructuredContent(), typed); err != nil {
+		e := fail(StageFromUnstructured)
+		e.Data = data
+		e.Err = err
+		return e
+	}
+
+	if !codecEquality.DeepEqual(object, typed) {
+		e := fail(StageUnstructured)
+		e.Decoded = typed
+		e.Data = data
+		e.Fields, e.Diff = h.fieldDiffs(object, typed)
+		return e
+	}
+	return nil
+}
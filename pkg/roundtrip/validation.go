@@ -0,0 +1,121 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validationCodecName is reported as the codec of validation panics that
+// happen before the object is round tripped.
+const validationCodecName = "validation"
+
+// ValidateFunc validates an object of the kind it was registered for.
+type ValidateFunc func(obj runtime.Object) field.ErrorList
+
+var (
+	validations = make(map[schema.GroupVersionKind]ValidateFunc)
+)
+
+// AddValidation registers the validation of a kind. After an object of that
+// kind is fuzzed it is validated, and validating it again after every round
+// trip must give the same result. A validation that panics is a failure too.
+func AddValidation(gvk schema.GroupVersionKind, validate ValidateFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	validations[gvk] = validate
+}
+
+// runValidation validates object and turns a panic into a *RoundTripError.
+func runValidation(gvk schema.GroupVersionKind, codecName string, validate ValidateFunc, object runtime.Object) (errs field.ErrorList, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &RoundTripError{
+				GVK:      gvk,
+				Codec:    codecName,
+				Stage:    StageValidationPanic,
+				Original: object,
+				Err:      fmt.Errorf("validation panicked: %v", r),
+			}
+		}
+	}()
+	return validate(object.DeepCopyObject()), nil
+}
+
+// checkValidation round trips object through codec and checks that the
+// decoded object validates the same way object did.
+func checkValidation(gvk schema.GroupVersionKind, mediaType string, codec runtime.Codec, validate ValidateFunc, object runtime.Object, before field.ErrorList) error {
+	data, err := runtime.Encode(codec, object.DeepCopyObject())
+	if err != nil {
+		return nil
+	}
+	decoded, err := runtime.Decode(codec, data)
+	if err != nil {
+		return nil
+	}
+
+	after, err := runValidation(gvk, mediaType, validate, decoded)
+	if err != nil {
+		return err
+	}
+
+	beforeMsgs, afterMsgs := errorMessages(before), errorMessages(after)
+	if !cmp.Equal(beforeMsgs, afterMsgs) {
+		return &RoundTripError{
+			GVK:      gvk,
+			Codec:    mediaType,
+			Stage:    StageValidationChanged,
+			Original: object,
+			Decoded:  decoded,
+			Data:     data,
+			Fields:   changedErrorFields(before, after),
+			Diff:     cmp.Diff(beforeMsgs, afterMsgs),
+		}
+	}
+	return nil
+}
+
+// errorMessages returns the sorted messages of errs, so that error lists can
+// be compared regardless of order and of the types of their bad values.
+func errorMessages(errs field.ErrorList) []string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+// changedErrorFields returns the fields that have errors in only one of the
+// lists.
+func changedErrorFields(before, after field.ErrorList) []string {
+	beforeMsgs := sets.NewString(errorMessages(before)...)
+	afterMsgs := sets.NewString(errorMessages(after)...)
+	fields := sets.NewString()
+	for _, err := range append(before, after...) {
+		if beforeMsgs.Has(err.Error()) != afterMsgs.Has(err.Error()) {
+			fields.Insert(err.Field)
+		}
+	}
+	return fields.List()
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 the kubefuzzing authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package roundtrip
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validateConfigMap requires the "key" entry and panics on "panic".
+func validateConfigMap(obj runtime.Object) field.ErrorList {
+	cm := obj.(*corev1.ConfigMap)
+	if _, ok := cm.Data["panic"]; ok {
+		panic("validation bug")
+	}
+	if _, ok := cm.Data["key"]; !ok {
+		return field.ErrorList{field.Required(field.NewPath("data").Key("key"), "")}
+	}
+	return nil
+}
+
+func TestCheckValidation(t *testing.T) {
+	jsonCodec := json.NewSerializer(json.DefaultMetaFactory, Scheme, Scheme, false)
+	if err := checkValidation(configMapGVK, runtime.ContentTypeJSON, jsonCodec, validateConfigMap, testConfigMap(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := checkValidation(configMapGVK, "lossy", lossyCodec{Codec: jsonCodec}, validateConfigMap, testConfigMap(), nil)
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageValidationChanged {
+		t.Errorf("expected stage %s, got %s", StageValidationChanged, rtErr.Stage)
+	}
+	if !reflect.DeepEqual(rtErr.Fields, []string{"data[key]"}) {
+		t.Errorf("expected data[key] to be reported, got %v", rtErr.Fields)
+	}
+}
+
+func TestRunValidationPanic(t *testing.T) {
+	cm := testConfigMap()
+	cm.Data["panic"] = ""
+	_, err := runValidation(configMapGVK, validationCodecName, validateConfigMap, cm)
+	var rtErr *RoundTripError
+	if !errors.As(err, &rtErr) {
+		t.Fatalf("expected a *RoundTripError, got %v", err)
+	}
+	if rtErr.Stage != StageValidationPanic {
+		t.Errorf("expected stage %s, got %s", StageValidationPanic, rtErr.Stage)
+	}
+}